@@ -1,7 +1,43 @@
 package main
 
-import "github.com/binsabit/authorization_practice/internal/api"
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/binsabit/authorization_practice/internal/api"
+)
+
+const usage = "usage: authorization_practice [serve | rotate-keys | cleanup-tokens | create-client -name NAME [-public] | set-user-status -id ID -status STATUS]"
 
 func main() {
-	api.StartServer()
+	if len(os.Args) < 2 {
+		api.StartServer()
+		return
+	}
+
+	switch os.Args[1] {
+	case "serve":
+		api.StartServer()
+	case "rotate-keys":
+		api.RotateKeys()
+	case "cleanup-tokens":
+		api.CleanupTokens()
+	case "create-client":
+		fs := flag.NewFlagSet("create-client", flag.ExitOnError)
+		name := fs.String("name", "", "client name")
+		public := fs.Bool("public", false, "register a public client without a secret")
+		fs.Parse(os.Args[2:])
+		api.CreateClient(*name, *public)
+	case "set-user-status":
+		fs := flag.NewFlagSet("set-user-status", flag.ExitOnError)
+		id := fs.Int64("id", 0, "user id")
+		status := fs.String("status", "", "new status: active, suspended or deleted")
+		fs.Parse(os.Args[2:])
+		api.SetUserStatus(*id, *status)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
 }
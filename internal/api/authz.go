@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/binsabit/authorization_practice/internal/authz"
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+// ExplainDecision evaluates the policies for any user and returns the full
+// trace, so an admin can see why a request is allowed or denied.
+func (app *application) ExplainDecision(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID   int64            `json:"user_id"`
+		Subject  authz.Attributes `json:"subject"`
+		Action   string           `json:"action"`
+		Resource authz.Resource   `json:"resource"`
+		Context  authz.Attributes `json:"context"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.UserID > 0, "user_id", "must be provided")
+	v.Check(input.Action != "", "action", "must be provided")
+	v.Check(input.Resource.Type != "", "resource", "must have a type")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByID(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_id", "no such user")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ctx := authz.WithContext(r.Context(), input.Context)
+	decision, err := app.authz.Authorize(ctx, authz.SubjectFromUser(user, input.Subject), input.Action, input.Resource)
+	if err != nil && !errors.Is(err, authz.ErrDenied) {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"decision": decision, "explanation": decision.Explain()}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
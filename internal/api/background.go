@@ -0,0 +1,170 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+)
+
+var (
+	cleanupRuns               = expvar.NewInt("janitor_runs_total")
+	cleanupTokensDeleted      = expvar.NewInt("janitor_tokens_deleted_total")
+	cleanupSessionsDeleted    = expvar.NewInt("janitor_sessions_deleted_total")
+	cleanupRevocationsDeleted = expvar.NewInt("janitor_revocations_deleted_total")
+	cleanupChallengesDeleted  = expvar.NewInt("janitor_webauthn_challenges_deleted_total")
+	cleanupOTPsDeleted        = expvar.NewInt("janitor_otps_deleted_total")
+)
+
+// background runs fn in its own goroutine, recovering from a panic so it
+// cannot take the server down. Shutdown waits for it to finish.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Printf("background task panicked: %v", err)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// every runs fn on each tick until the server shuts down. Shutdown waits for
+// a run that is in progress to finish.
+func (app *application) every(interval time.Duration, fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// maintainKeys reloads the keyring so rotations done by other processes are
+// seen, and rotates the active key when it is due.
+func (app *application) maintainKeys() {
+	keyring := app.models.Tokens.Keys
+
+	err := keyring.Reload()
+	if err != nil {
+		app.logger.Printf("reloading signing keys: %v", err)
+		return
+	}
+
+	rotated, err := keyring.RotateIfDue()
+	if err != nil {
+		app.logger.Printf("rotating signing keys: %v", err)
+		return
+	}
+	if rotated {
+		app.logger.Printf("rotated signing key, next key will be active in %s", app.config.keys.propagation)
+	}
+}
+
+// syncRevocations keeps the in-memory revocation list in step with revocations
+// made by other instances.
+func (app *application) syncRevocations() {
+	err := app.models.Revocations.Sync()
+	if err != nil {
+		app.logger.Printf("syncing revocations: %v", err)
+	}
+}
+
+// reloadPolicies picks up edits to the policy files. A file that no longer
+// parses is reported and the policies already loaded stay in use.
+func (app *application) reloadPolicies() {
+	err := app.authz.Reload()
+	if err != nil {
+		app.logger.Printf("reloading authorization policies: %v", err)
+	}
+}
+
+// cleanup is the janitor run by the server on a schedule.
+func (app *application) cleanup() {
+	result, err := cleanup(app.models, app.config.janitor.batchSize, app.shutdown)
+	if err != nil {
+		app.logger.Printf("cleaning up tokens: %v", err)
+	}
+	if result.total() > 0 {
+		app.logger.Printf("cleaned up %s", result)
+	}
+}
+
+type cleanupResult struct {
+	tokens      int64
+	sessions    int64
+	revocations int64
+	challenges  int64
+	otps        int64
+}
+
+func (r cleanupResult) total() int64 {
+	return r.tokens + r.sessions + r.revocations + r.challenges + r.otps
+}
+
+func (r cleanupResult) String() string {
+	return fmt.Sprintf("%d tokens, %d sessions, %d revocations, %d webauthn challenges, %d one-time passcodes", r.tokens, r.sessions, r.revocations, r.challenges, r.otps)
+}
+
+// cleanup deletes expired tokens, then the sessions and revocations they leave
+// behind, the challenges of abandoned WebAuthn ceremonies and expired
+// one-time passcodes, in batches of batchSize so no single statement holds locks for
+// long. It stops between batches once done is closed.
+func cleanup(models data.Models, batchSize int, done <-chan struct{}) (cleanupResult, error) {
+	var result cleanupResult
+
+	steps := []struct {
+		deleteBatch func(int) (int64, error)
+		count       *int64
+		metric      *expvar.Int
+	}{
+		{models.Tokens.DeleteExpired, &result.tokens, cleanupTokensDeleted},
+		{models.Sessions.DeleteStale, &result.sessions, cleanupSessionsDeleted},
+		{models.Revocations.DeleteExpired, &result.revocations, cleanupRevocationsDeleted},
+		{models.WebAuthn.DeleteExpiredChallenges, &result.challenges, cleanupChallengesDeleted},
+		{models.OTP.DeleteExpired, &result.otps, cleanupOTPsDeleted},
+	}
+
+	cleanupRuns.Add(1)
+
+	for _, step := range steps {
+		for {
+			select {
+			case <-done:
+				return result, nil
+			default:
+			}
+
+			n, err := step.deleteBatch(batchSize)
+			if err != nil {
+				return result, err
+			}
+
+			*step.count += n
+			step.metric.Add(n)
+
+			if n < int64(batchSize) {
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -3,13 +3,22 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/binsabit/authorization_practice/internal/authz"
 	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/keys"
+	"github.com/binsabit/authorization_practice/internal/mailer"
+	"github.com/binsabit/authorization_practice/internal/sender"
 	_ "github.com/lib/pq"
 )
 
@@ -25,12 +34,77 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	keys struct {
+		dir         string
+		algorithm   string
+		rotateEvery time.Duration
+		propagation time.Duration
+		retention   time.Duration
+	}
+	jwt struct {
+		issuer     string
+		audience   []string
+		leeway     time.Duration
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	janitor struct {
+		interval  time.Duration
+		batchSize int
+	}
+	mailer struct {
+		// kind is one of "log", "file" or "smtp".
+		kind     string
+		dir      string
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	authz struct {
+		dir string
+		// location is the time zone policies see the time of day in.
+		location string
+		// namespaces is the file defining relation tuple namespaces.
+		namespaces string
+	}
+	mfa struct {
+		// issuer names this service in authenticator apps.
+		issuer string
+	}
+	sender struct {
+		// kind is one of "log", "file" or "smtp". The smtp sender uses the
+		// mailer's server and delivers SMS through smsGateway, if set.
+		kind       string
+		dir        string
+		smsGateway string
+	}
+	magicLink struct {
+		// url is where links in magic-link emails point, with the token
+		// added as the "token" query parameter. It defaults to the API's
+		// own verify endpoint; a frontend can take the token and call
+		// that instead.
+		url string
+	}
+	webauthn struct {
+		// rpID is the domain passkeys are bound to, and origins the
+		// origins of the pages that register and use them.
+		rpID    string
+		rpName  string
+		origins []string
+	}
 }
 
 type application struct {
-	logger *log.Logger
-	config config
-	models data.Models
+	logger   *log.Logger
+	config   config
+	models   data.Models
+	mailer   mailer.Mailer
+	sender   sender.Sender
+	authz    *authz.Engine
+	shutdown chan struct{}
+	wg       sync.WaitGroup
 }
 
 func configure() config {
@@ -55,6 +129,90 @@ func configure() config {
 			maxIdleConns: 25,
 			maxIdleTime:  "15m",
 		},
+		keys: struct {
+			dir         string
+			algorithm   string
+			rotateEvery time.Duration
+			propagation time.Duration
+			retention   time.Duration
+		}{
+			dir:         "keys",
+			algorithm:   keys.AlgES256,
+			rotateEvery: 30 * 24 * time.Hour,
+			propagation: 10 * time.Minute,
+			retention:   time.Hour,
+		},
+		jwt: struct {
+			issuer     string
+			audience   []string
+			leeway     time.Duration
+			accessTTL  time.Duration
+			refreshTTL time.Duration
+		}{
+			issuer:     "http://localhost:4000",
+			audience:   []string{"authorization_practice"},
+			leeway:     30 * time.Second,
+			accessTTL:  15 * time.Minute,
+			refreshTTL: 7 * 24 * time.Hour,
+		},
+		janitor: struct {
+			interval  time.Duration
+			batchSize int
+		}{
+			interval:  time.Hour,
+			batchSize: 1000,
+		},
+		mailer: struct {
+			kind     string
+			dir      string
+			host     string
+			port     int
+			username string
+			password string
+			sender   string
+		}{
+			kind:   "log",
+			dir:    "mail",
+			host:   "localhost",
+			port:   25,
+			sender: "Authorization Practice <no-reply@localhost>",
+		},
+		authz: struct {
+			dir        string
+			location   string
+			namespaces string
+		}{
+			dir:        "policies",
+			location:   "UTC",
+			namespaces: "namespaces.json",
+		},
+		mfa: struct {
+			issuer string
+		}{
+			issuer: "Authorization Practice",
+		},
+		sender: struct {
+			kind       string
+			dir        string
+			smsGateway string
+		}{
+			kind: "log",
+			dir:  "messages",
+		},
+		magicLink: struct {
+			url string
+		}{
+			url: "http://localhost:4000/auth/magic-link/verify",
+		},
+		webauthn: struct {
+			rpID    string
+			rpName  string
+			origins []string
+		}{
+			rpID:    "localhost",
+			rpName:  "Authorization Practice",
+			origins: []string{"http://localhost:4000", "http://localhost:3000"},
+		},
 	}
 }
 
@@ -69,10 +227,31 @@ func StartServer() {
 	}
 
 	defer db.Close()
+
+	keyring, err := openKeyring(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	engine, err := openAuthz(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("loaded %d authorization policies from %s", engine.Len(), config.authz.dir)
+
+	namespaces, err := data.LoadNamespaces(config.authz.namespaces)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	app := &application{
-		logger: logger,
-		config: config,
-		models: data.NewModels(db),
+		logger:   logger,
+		config:   config,
+		models:   newModels(config, db, keyring, namespaces),
+		mailer:   newMailer(config, logger),
+		sender:   newSender(config, logger),
+		authz:    engine,
+		shutdown: make(chan struct{}),
 	}
 
 	srv := &http.Server{
@@ -83,10 +262,95 @@ func StartServer() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	err = app.models.Revocations.Sync()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	app.every(time.Minute, app.maintainKeys)
+	app.every(10*time.Second, app.syncRevocations)
+	app.every(time.Minute, app.reloadPolicies)
+	app.every(config.janitor.interval, app.cleanup)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-quit
+
+		logger.Printf("shutting down server, caught %s", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+
+		close(app.shutdown)
+		app.wg.Wait()
+
+		shutdownError <- err
+	}()
+
 	logger.Printf("starting server on %s", srv.Addr)
 
 	err = srv.ListenAndServe()
-	logger.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Printf("stopped server on %s", srv.Addr)
+}
+
+// smtpMailer is the one SMTP client, shared by the mailer and the sender.
+func smtpMailer(cfg config) mailer.SMTP {
+	return mailer.SMTP{
+		Host:     cfg.mailer.host,
+		Port:     cfg.mailer.port,
+		Username: cfg.mailer.username,
+		Password: cfg.mailer.password,
+		Sender:   cfg.mailer.sender,
+	}
+}
+
+func newMailer(cfg config, logger *log.Logger) mailer.Mailer {
+	switch cfg.mailer.kind {
+	case "smtp":
+		return smtpMailer(cfg)
+	case "file":
+		return mailer.File{Dir: cfg.mailer.dir, Sender: cfg.mailer.sender}
+	default:
+		return mailer.Log{Logger: logger}
+	}
+}
+
+func newSender(cfg config, logger *log.Logger) sender.Sender {
+	switch cfg.sender.kind {
+	case "smtp":
+		return sender.SMTP{
+			Mailer:     smtpMailer(cfg),
+			Subject:    "Your sign-in code",
+			SMSGateway: cfg.sender.smsGateway,
+		}
+	case "file":
+		return sender.File{Dir: cfg.sender.dir}
+	default:
+		return sender.Log{Logger: logger}
+	}
+}
+
+func newModels(cfg config, db *sql.DB, keyring *keys.Keyring, namespaces *data.NamespaceConfig) data.Models {
+	return data.NewModels(db, keyring, data.ClaimsOptions{
+		Issuer:    cfg.jwt.issuer,
+		Audience:  cfg.jwt.audience,
+		Leeway:    cfg.jwt.leeway,
+		AccessTTL: cfg.jwt.accessTTL,
+	}, namespaces)
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -116,3 +380,120 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openKeyring(cfg config) (*keys.Keyring, error) {
+	return keys.Open(cfg.keys.dir, keys.Options{
+		Algorithm:   cfg.keys.algorithm,
+		RotateEvery: cfg.keys.rotateEvery,
+		Propagation: cfg.keys.propagation,
+		Retention:   cfg.keys.retention,
+	})
+}
+
+func openAuthz(cfg config) (*authz.Engine, error) {
+	location, err := time.LoadLocation(cfg.authz.location)
+	if err != nil {
+		return nil, err
+	}
+	return authz.Open(cfg.authz.dir, authz.Options{Location: location})
+}
+
+// RotateKeys generates a new signing key. Running servers publish it on their
+// next reload and start signing with it after the propagation delay.
+func RotateKeys() {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	keyring, err := openKeyring(configure())
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	key, err := keyring.Rotate()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Printf("generated %s signing key %s", key.Algorithm, key.ID)
+}
+
+// CreateClient registers an OAuth client and prints its credentials. The
+// secret cannot be recovered later.
+func CreateClient(name string, public bool) {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	db, err := openDB(configure())
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	client := &data.Client{Name: name}
+
+	v := validator.New()
+	if data.ValidateClient(v, client); !v.Valid() {
+		logger.Fatal(v.Errors)
+	}
+
+	err = data.ClientModel{DB: db}.Insert(client, public)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	fmt.Printf("client_id:     %s\n", client.ID)
+	if !public {
+		fmt.Printf("client_secret: %s\n", client.Secret)
+	}
+}
+
+// CleanupTokens runs the janitor once, for use from cron when the server's own
+// schedule is not enough.
+func CleanupTokens() {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	config := configure()
+
+	db, err := openDB(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	// The janitor never signs or verifies tokens nor reads relation
+	// tuples, so it needs neither the keyring nor the namespaces.
+	result, err := cleanup(newModels(config, db, nil, nil), config.janitor.batchSize, nil)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Printf("cleaned up %s", result)
+}
+
+// SetUserStatus changes a user's status from the command line, for example to
+// suspend an account.
+func SetUserStatus(userID int64, status string) {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	config := configure()
+
+	db, err := openDB(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{
+		logger: logger,
+		config: config,
+		models: newModels(config, db, nil, nil),
+	}
+
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = app.setUserStatus(user, status)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Printf("user %d is now %s", user.ID, user.Status)
+}
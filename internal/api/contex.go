@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey         = contextKey("user")
+	refreshTokenContextKey = contextKey("refresh_token")
+	accessTokenContextKey  = contextKey("access_token")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -23,3 +27,48 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetRefreshToken(r *http.Request, token *data.Token) *http.Request {
+	ctx := context.WithValue(r.Context(), refreshTokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRefreshToken(r *http.Request) *data.Token {
+	token, ok := r.Context().Value(refreshTokenContextKey).(*data.Token)
+	if !ok {
+		panic("missing refresh token value in request context")
+	}
+	return token
+}
+
+func (app *application) contextSetAccessToken(r *http.Request, claims *data.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), accessTokenContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetAccessToken returns the claims of the access token that
+// authenticated the request, or nil for anonymous requests.
+func (app *application) contextGetAccessToken(r *http.Request) *data.Claims {
+	claims, _ := r.Context().Value(accessTokenContextKey).(*data.Claims)
+	return claims
+}
+
+// contextGetOrgID returns the organization the access token acts in, or 0
+// when it acts in none.
+func (app *application) contextGetOrgID(r *http.Request) int64 {
+	token := app.contextGetAccessToken(r)
+	if token == nil {
+		return 0
+	}
+	return token.OrgID
+}
+
+// contextGetSessionID returns the session the access token was issued for, or
+// an empty string for anonymous requests.
+func (app *application) contextGetSessionID(r *http.Request) string {
+	token := app.contextGetAccessToken(r)
+	if token == nil {
+		return ""
+	}
+	return token.SessionID
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -31,13 +32,45 @@ func (app *application) RefreshSession(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	if user.IsAnonymous() {
 		helpers.MethodNotAllowedResponse(w, r)
+		return
 	}
-	err := app.models.Tokens.DeleteAllForUser(data.TypeRefresh, user.ID)
+
+	refreshToken := app.contextGetRefreshToken(r)
+
+	session, err := app.models.Sessions.Get(refreshToken.FamilyID)
 	if err != nil {
-		helpers.ServerErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidAuthenticationTokenResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
 		return
 	}
-	token, err := app.models.Tokens.NewAuthToken(*user, time.Minute*15, time.Hour*24*7)
+
+	// A session left in an organization its user was removed from carries
+	// on outside any organization.
+	if session.OrgID != 0 && session.OrgRole == "" {
+		err = app.models.Sessions.SetOrg(session.ID, 0)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+		session.OrgID = 0
+	}
+
+	token, err := app.models.Tokens.RotateAuthToken(*user, session, refreshToken, app.config.jwt.accessTTL, app.config.jwt.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.revokeTokenFamily(w, r, refreshToken)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Sessions.Touch(session.ID, clientIP(r))
 	if err != nil {
 		helpers.ServerErrorResponse(w, r, err)
 		return
@@ -54,9 +87,9 @@ func (app *application) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
 		Login    string `json:"login"`
+		Email    string `json:"email"`
+		Phone    string `json:"phone"`
 		Password string `json:"password"`
-		Status   string `json:"status"`
-		Role     string `json:"role"`
 		Name     string `json:"name"`
 	}
 
@@ -68,9 +101,11 @@ func (app *application) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	user := &data.User{
 		Login:  input.Login,
+		Email:  input.Email,
+		Phone:  input.Phone,
 		Name:   input.Name,
-		Status: input.Status,
-		Role:   input.Role,
+		Status: data.StatusPending,
+		Role:   data.RoleUser,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -82,6 +117,7 @@ func (app *application) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	if data.ValidateUser(v, user); !v.Valid() {
 		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
 	}
 	err = app.models.Users.Insert(user)
 	if err != nil {
@@ -89,25 +125,112 @@ func (app *application) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, data.ErrDuplicateLogin):
 			helpers.BadRequestResponse(w, r, err)
 			// app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			helpers.FailedValidationResponse(w, r, v.Errors)
 		default:
 			helpers.ServerErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"user": user}, nil)
+	token, err := app.models.Tokens.NewToken(*user, data.ScopeActivation, 3*24*time.Hour)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		mailData := map[string]interface{}{
+			"name":            user.Name,
+			"activationToken": token.Plaintext,
+		}
+
+		err := app.mailer.Send(user.Email, "user_activation.tmpl", mailData)
+		if err != nil {
+			app.logger.Printf("sending activation email to user %d: %v", user.ID, err)
+		}
+	})
+
+	err = helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{"user": user}, nil)
 	if err != nil {
 		helpers.ServerErrorResponse(w, r, err)
 	}
 
 }
 
+func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Status != data.StatusPending {
+		v.AddError("token", "account is not awaiting activation")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.TransitionTo(data.StatusActive)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) LoginUser(w http.ResponseWriter, r *http.Request) {
 	app.logger.Println("Signing in user")
 
 	var input struct {
-		Login    string `json:"login"`
-		Password string `json:"password"`
+		Login      string `json:"login"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
+		ClientID   string `json:"client_id"`
 	}
 
 	err := helpers.ReadJSON(w, r, &input)
@@ -122,6 +245,7 @@ func (app *application) LoginUser(w http.ResponseWriter, r *http.Request) {
 
 	if !v.Valid() {
 		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	user, err := app.models.Users.GetByLogin(input.Login)
@@ -147,13 +271,57 @@ func (app *application) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.TypeRefresh, user.ID)
+	if app.rejectInactiveUser(w, r, user) {
+		return
+	}
+
+	mfaEnabled, err := app.models.TOTP.IsEnabled(user.ID)
 	if err != nil {
 		helpers.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.NewAuthToken(*user, time.Minute*15, time.Hour*24*7)
+	if mfaEnabled {
+		app.requireSecondFactor(w, r, user)
+		return
+	}
+
+	app.startSession(w, r, user, input.DeviceName, input.ClientID)
+}
+
+// startSession signs the user in on a new device and responds with the
+// session's first token pair.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *data.User, deviceName, clientID string) {
+	if clientID != "" {
+		_, err := app.models.Clients.Get(clientID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v := validator.New()
+				v.AddError("client_id", "unknown client")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	session := &data.Session{
+		UserID:     user.ID,
+		ClientID:   clientID,
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+	}
+
+	err := app.models.Sessions.Insert(session)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.NewAuthToken(*user, session, app.config.jwt.accessTTL, app.config.jwt.refreshTTL)
 	if err != nil {
 		helpers.ServerErrorResponse(w, r, err)
 		return
@@ -169,8 +337,23 @@ func (app *application) LogoutUser(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	if user.IsAnonymous() {
 		helpers.MethodNotAllowedResponse(w, r)
+		return
+	}
+
+	accessToken := app.contextGetAccessToken(r)
+	err := app.models.Revocations.Revoke(data.RevokeToken, accessToken.ID, time.Until(accessToken.ExpiresAtTime()))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// Access tokens issued before sessions existed carry no session, so
+	// fall back to ending every session the user has.
+	if accessToken.SessionID != "" {
+		err = app.endSession(accessToken.SessionID)
+	} else {
+		err = app.models.Tokens.DeleteAllForUser(data.TypeRefresh, user.ID)
 	}
-	err := app.models.Tokens.DeleteAllForUser(data.TypeRefresh, user.ID)
 	if err != nil {
 		helpers.ServerErrorResponse(w, r, err)
 		return
@@ -178,3 +361,38 @@ func (app *application) LogoutUser(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "user logged out"}, nil)
 
 }
+
+func (app *application) JWKS(w http.ResponseWriter, r *http.Request) {
+	headers := http.Header{"Cache-Control": []string{"public, max-age=300"}}
+
+	err := helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"keys": app.models.Tokens.Keys.JWKS()}, headers)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// revokeTokenFamily handles a refresh token that was presented after it had
+// already been rotated. Either the client or an attacker holds a stolen copy,
+// so the session owning the family is ended and the user has to log in again
+// on that device.
+func (app *application) revokeTokenFamily(w http.ResponseWriter, r *http.Request, token *data.Token) {
+	app.logger.Printf("refresh token reuse detected for user %d, revoking family %s", token.UserID, token.FamilyID)
+
+	if token.FamilyID != "" {
+		err := app.endSession(token.FamilyID)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	helpers.InvalidAuthenticationTokenResponse(w, r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
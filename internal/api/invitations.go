@@ -0,0 +1,376 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// InviteMember invites someone into the current organization by login or
+// email address. An existing user is invited at the address on their
+// account.
+func (app *application) InviteMember(w http.ResponseWriter, r *http.Request) {
+	inviter := app.contextGetUser(r)
+	orgID := app.contextGetOrgID(r)
+
+	var input struct {
+		Login string `json:"login"`
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = data.RoleUser
+	}
+
+	v := validator.New()
+	v.Check(input.Login != "" || input.Email != "", "email", "either login or email must be provided")
+	v.Check(input.Login == "" || input.Email == "", "email", "must not be provided together with login")
+	if input.Email != "" {
+		data.ValidateEmail(v, input.Email)
+	}
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A member can only invite at a role that grants no more than their own,
+	// or members:write would be enough to bring in an admin.
+	membership, err := app.models.Organizations.GetMembership(orgID, inviter.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotPermittedResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	granted, err := app.models.Permissions.GetAllForRole(membership.Role)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	requested, err := app.models.Permissions.GetAllForRole(input.Role)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !granted.Covers(requested) {
+		v.AddError("role", "must not grant permissions you do not have")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var invitee *data.User
+	if input.Login != "" {
+		invitee, err = app.models.Users.GetByLogin(input.Login)
+	} else {
+		invitee, err = app.models.Users.GetByEmail(input.Email)
+	}
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		if input.Login != "" {
+			v.AddError("login", "no user with this login exists, invite them by email instead")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+	case err != nil:
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	email := input.Email
+	if invitee != nil {
+		if invitee.Email == "" {
+			v.AddError("login", "this user has no email address to send the invitation to")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+		email = invitee.Email
+
+		_, err = app.models.Organizations.GetMembership(orgID, invitee.ID)
+		switch {
+		case err == nil:
+			v.AddError("email", "this user is already a member")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	org, err := app.models.Organizations.Get(orgID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.NewToken(*inviter, data.ScopeInvitation, invitationTTL)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	invitation := &data.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      input.Role,
+		InvitedBy: inviter.ID,
+	}
+
+	err = app.models.Invitations.Insert(invitation, token)
+	if err != nil {
+		// The token is useless without its invitation.
+		if delErr := app.models.Tokens.Delete(token); delErr != nil {
+			app.logger.Printf("deleting token of failed invitation: %v", delErr)
+		}
+
+		switch {
+		case errors.Is(err, data.ErrUnknownRole):
+			v.AddError("role", "does not exist")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendInvitation(inviter, org, invitation, token)
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"invitation": invitation}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) sendInvitation(inviter *data.User, org *data.Organization, invitation *data.Invitation, token *data.Token) {
+	app.background(func() {
+		mailData := map[string]interface{}{
+			"orgName":         org.Name,
+			"inviterName":     inviter.Name,
+			"role":            invitation.Role,
+			"invitationToken": token.Plaintext,
+		}
+
+		err := app.mailer.Send(invitation.Email, "invitation.tmpl", mailData)
+		if err != nil {
+			app.logger.Printf("sending invitation %d: %v", invitation.ID, err)
+		}
+	})
+}
+
+// getInvitationParam loads the pending invitation named in the URL from the
+// current organization, writing the error response itself when that fails.
+func (app *application) getInvitationParam(w http.ResponseWriter, r *http.Request) (*data.Invitation, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		helpers.NotFoundResponse(w, r)
+		return nil, false
+	}
+
+	invitation, err := app.models.Invitations.Get(id, app.contextGetOrgID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return invitation, true
+}
+
+func (app *application) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := app.models.Invitations.GetAllForOrg(app.contextGetOrgID(r))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"invitations": invitations}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ResendInvitation emails a new token for a pending invitation, which also
+// restarts its expiry. The token sent before stops working.
+func (app *application) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	invitation, ok := app.getInvitationParam(w, r)
+	if !ok {
+		return
+	}
+
+	org, err := app.models.Organizations.Get(invitation.OrgID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.NewToken(*user, data.ScopeInvitation, invitationTTL)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Invitations.SetToken(invitation, token)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	app.sendInvitation(user, org, invitation, token)
+
+	err = helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{"invitation": invitation}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := app.getInvitationParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Invitations.Delete(invitation)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "invitation cancelled"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// AcceptInvitation adds the invitee to the organization with the role the
+// inviter chose. A signed in user joins as themselves, if the invitation was
+// sent to their email address. Otherwise a new account is registered from
+// login, password and name; it is active at once since the token proves the
+// email address.
+func (app *application) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Login    string `json:"login"`
+		Password string `json:"password"`
+		Name     string `json:"name"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitation, err := app.models.Invitations.GetForToken(input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	status := http.StatusOK
+
+	if !user.IsAnonymous() && !strings.EqualFold(user.Email, invitation.Email) {
+		v.AddError("token", "this invitation was sent to a different email address")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if user.IsAnonymous() {
+		_, err = app.models.Users.GetByEmail(invitation.Email)
+		switch {
+		case err == nil:
+			v.AddError("token", "an account with this email address exists, log in to accept the invitation")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		user = &data.User{
+			Login:  input.Login,
+			Email:  invitation.Email,
+			Name:   input.Name,
+			Status: data.StatusActive,
+			Role:   data.RoleUser,
+		}
+
+		err = user.Password.Set(input.Password)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if data.ValidateUser(v, user); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	err = app.models.Invitations.Accept(invitation, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateLogin):
+			v.AddError("login", "a user with this login already exists")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateMembership):
+			v.AddError("token", "you are already a member of this organization")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership := &data.Membership{OrgID: invitation.OrgID, UserID: user.ID, Role: invitation.Role}
+
+	err = helpers.WriteJSON(w, status, helpers.Envelope{"user": user, "membership": membership}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
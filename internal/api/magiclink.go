@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// magicLinkURL returns the link to email for a magic-link token.
+func (app *application) magicLinkURL(token string) (string, error) {
+	u, err := url.Parse(app.config.magicLink.url)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// RequestMagicLink emails a link that signs the user in without a password.
+// Like RequestPasswordReset, it answers the same whether or not the address
+// belongs to a user, and looks the user up after responding. A request over
+// the per-user limits gets the same answer and sends nothing.
+func (app *application) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.Printf("looking up user for magic link: %v", err)
+			}
+			return
+		}
+
+		if user.Status == data.StatusSuspended || user.Status == data.StatusDeleted {
+			return
+		}
+
+		token, err := app.models.Tokens.NewMagicLinkToken(*user, magicLinkTTL)
+		if err != nil {
+			if !errors.Is(err, data.ErrMagicLinkCooldown) && !errors.Is(err, data.ErrMagicLinkLimit) {
+				app.logger.Printf("creating magic link token for user %d: %v", user.ID, err)
+			}
+			return
+		}
+
+		link, err := app.magicLinkURL(token.Plaintext)
+		if err != nil {
+			app.logger.Printf("building magic link for user %d: %v", user.ID, err)
+			return
+		}
+
+		mailData := map[string]interface{}{
+			"name":         user.Name,
+			"magicLinkURL": link,
+		}
+
+		err = app.mailer.Send(user.Email, "magic_link.tmpl", mailData)
+		if err != nil {
+			app.logger.Printf("sending magic link email to user %d: %v", user.ID, err)
+		}
+	})
+
+	message := "if an account with that email address exists, you will receive a sign-in link"
+	err = helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{"message": message}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// VerifyMagicLink exchanges the token from a magic link for a session. The
+// token is used up whatever happens next. Opening the link proves the user
+// owns the address, so an account still awaiting activation is activated.
+// Users with two-factor authentication still have to give a code.
+//
+// The device_name and client_id query parameters play the part of the
+// fields of the same name in LoginUser.
+func (app *application) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	token := query.Get("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMagicLink, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidAuthenticationTokenResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.Consume(data.ScopeMagicLink, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidAuthenticationTokenResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Status == data.StatusPending {
+		err = app.setUserStatus(user, data.StatusActive)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				helpers.EditConflictResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.rejectInactiveUser(w, r, user) {
+		return
+	}
+
+	mfaEnabled, err := app.models.TOTP.IsEnabled(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if mfaEnabled {
+		app.requireSecondFactor(w, r, user)
+		return
+	}
+
+	app.startSession(w, r, user, query.Get("device_name"), query.Get("client_id"))
+}
@@ -0,0 +1,486 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/binsabit/authorization_practice/internal/totp"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const mfaPendingTTL = 5 * time.Minute
+
+// requireSecondFactor answers a correct password for a user with two-factor
+// authentication enabled. Instead of tokens the client gets a short-lived
+// mfa-pending token to send back along with a code.
+func (app *application) requireSecondFactor(w http.ResponseWriter, r *http.Request, user *data.User) {
+	token, err := app.models.Tokens.NewToken(*user, data.ScopeMFAPending, mfaPendingTTL)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	env := helpers.Envelope{"mfa_required": "totp", "mfa_token": token}
+	err = helpers.WriteJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// verifySecondFactor accepts either a code from the authenticator or one of
+// the user's recovery codes, which is used up. Neither is checked while the
+// user is locked out for giving too many wrong ones, which is reported as
+// data.ErrTOTPLocked.
+func (app *application) verifySecondFactor(enrollment *data.TOTP, code, recoveryCode string) (bool, error) {
+	if enrollment.Locked(time.Now()) {
+		return false, data.ErrTOTPLocked
+	}
+	if recoveryCode == "" {
+		return app.models.TOTP.Verify(enrollment, code)
+	}
+
+	ok, err := app.models.RecoveryCodes.Use(enrollment.UserID, recoveryCode)
+	if err != nil || ok {
+		return ok, err
+	}
+	return false, app.models.TOTP.RecordFailure(enrollment)
+}
+
+// reauthenticate has the signed in user prove who they are again, with the
+// password and, if two-factor authentication is enabled, a code or recovery
+// code, before a change that would let someone holding only a stolen access
+// token keep access to the account. If they cannot it writes the response
+// and returns false.
+func (app *application) reauthenticate(w http.ResponseWriter, r *http.Request, user *data.User, password, code, recoveryCode string) bool {
+	matched, err := user.Password.Matches(password)
+	if err != nil || !matched {
+		helpers.InvalidCredentialsResponse(w, r)
+		return false
+	}
+
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return true
+	case err != nil:
+		helpers.ServerErrorResponse(w, r, err)
+		return false
+	case !enrollment.Confirmed:
+		return true
+	}
+
+	if code == "" && recoveryCode == "" {
+		v := validator.New()
+		v.AddError("code", "either code or recovery_code must be provided")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	ok, err := app.verifySecondFactor(enrollment, code, recoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPLocked):
+			helpers.TooManyAttemptsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return false
+	}
+	if !ok {
+		helpers.InvalidCredentialsResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// LoginTOTP completes a login started with a password by exchanging the
+// mfa-pending token and a code from the authenticator, or a recovery code,
+// for a session.
+func (app *application) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		DeviceName   string `json:"device_name"`
+		ClientID     string `json:"client_id"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.MFAToken != "", "mfa_token", "must be provided")
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "either code or recovery_code must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMFAPending, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidAuthenticationTokenResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.rejectInactiveUser(w, r, user) {
+		return
+	}
+
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// Two-factor authentication was turned off since the password was
+	// checked; the pending login cannot be completed with a code.
+	if enrollment == nil || !enrollment.Confirmed {
+		helpers.InvalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(enrollment, input.Code, input.RecoveryCode)
+	if err != nil && !errors.Is(err, data.ErrTOTPLocked) {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		// Once locked out the pending login is over; a new one can only
+		// be started after the lockout, with the password again.
+		if enrollment.Locked(time.Now()) {
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeMFAPending, user.ID)
+			if err != nil {
+				helpers.ServerErrorResponse(w, r, err)
+				return
+			}
+			helpers.TooManyAttemptsResponse(w, r)
+			return
+		}
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFAPending, user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	app.startSession(w, r, user, input.DeviceName, input.ClientID)
+}
+
+// EnrollTOTP starts setting up an authenticator app. The secret is returned
+// as text, as an otpauth:// URI and as a QR code of that URI, and only takes
+// effect once ConfirmTOTP sees a code generated from it. The password is
+// required so an access token alone cannot put someone else's authenticator
+// on the account.
+func (app *application) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Checked first, or reauthenticate would ask for a code when the answer
+	// is that there is nothing to enroll.
+	enabled, err := app.models.TOTP.IsEnabled(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+	if enabled {
+		v.AddError("totp", "is already enabled, disable it first to enroll a new authenticator")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password, "", "") {
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.Enroll(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPEnabled):
+			v.AddError("totp", "is already enabled, disable it first to enroll a new authenticator")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	uri := totp.URI(app.config.mfa.issuer, user.Login, secret)
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	env := helpers.Envelope{"totp": helpers.Envelope{
+		"secret":  totp.EncodeSecret(secret),
+		"uri":     uri,
+		"qr_code": "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ConfirmTOTP turns two-factor authentication on once the user has shown
+// their authenticator produces valid codes, and hands out the recovery codes
+// to use should the authenticator be lost.
+func (app *application) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Code != "", "code", "must be provided"); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("code", "no authenticator is being enrolled")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrollment.Confirmed {
+		v.AddError("code", "two-factor authentication is already enabled")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.models.TOTP.Verify(enrollment, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPLocked):
+			helpers.TooManyAttemptsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		v.AddError("code", "is invalid or expired")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TOTP.Confirm(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	codes, err := app.models.RecoveryCodes.Generate(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	env := helpers.Envelope{"message": "two-factor authentication enabled", "recovery_codes": codes}
+	err = helpers.WriteJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// DisableTOTP turns two-factor authentication off. It takes the password and
+// a current code or recovery code so a stolen access token alone cannot
+// weaken the account.
+func (app *application) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "either code or recovery_code must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	matched, err := user.Password.Matches(input.Password)
+	if err != nil || !matched {
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrollment.Confirmed {
+		ok, err := app.verifySecondFactor(enrollment, input.Code, input.RecoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrTOTPLocked):
+				helpers.TooManyAttemptsResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !ok {
+			helpers.InvalidCredentialsResponse(w, r)
+			return
+		}
+	}
+
+	err = app.models.TOTP.Delete(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.RecoveryCodes.DeleteAllForUser(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "two-factor authentication disabled"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ShowRecoveryCodes tells how many unused recovery codes the user has left.
+// The codes themselves are only shown when they are generated.
+func (app *application) ShowRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	count, err := app.models.RecoveryCodes.Count(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"remaining": count}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// with a new set. It takes the password and a code or recovery code, as new
+// recovery codes are a second factor of their own.
+func (app *application) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	enabled, err := app.models.TOTP.IsEnabled(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+	if !enabled {
+		v.AddError("totp", "must be enabled to have recovery codes")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := app.models.RecoveryCodes.Generate(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
@@ -2,17 +2,16 @@ package api
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
 	data "github.com/binsabit/authorization_practice/internal/data/models"
 	"github.com/binsabit/authorization_practice/internal/data/validator"
 	"github.com/binsabit/authorization_practice/internal/helpers"
-	"github.com/golang-jwt/jwt"
 )
 
+var errInvalidAccessToken = errors.New("invalid access token")
+
 func (app *application) IsAuthorizedJWT(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -24,8 +23,6 @@ func (app *application) IsAuthorizedJWT(next http.HandlerFunc) http.HandlerFunc
 			return
 		}
 
-		mySigningKey := []byte(data.Secretkey)
-
 		headerParts := strings.Split(authorizationHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			helpers.InvalidAuthenticationTokenResponse(w, r)
@@ -40,29 +37,147 @@ func (app *application) IsAuthorizedJWT(next http.HandlerFunc) http.HandlerFunc
 			return
 		}
 
-		token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
-			return mySigningKey, nil
-		})
-
+		claims, err := app.parseAccessToken(rawToken)
 		if err != nil {
 			helpers.InvalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userIDStr := fmt.Sprintf("%v", claims["user_id"])
-			userIDInt, _ := strconv.ParseInt(userIDStr, 10, 64)
-			user, err := app.models.Users.GetByID(userIDInt)
-			if err != nil {
+		userID, _ := claims.UserID()
+		user, err := app.models.Users.GetByID(userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				helpers.InvalidAuthenticationTokenResponse(w, r)
+			default:
 				helpers.ServerErrorResponse(w, r, err)
 			}
-			r = app.contextSetUser(r, user)
-			next.ServeHTTP(w, r)
+			return
 		}
 
+		if app.rejectInactiveUser(w, r, user) {
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		r = app.contextSetAccessToken(r, claims)
+		next.ServeHTTP(w, r)
 	})
 }
 
+// parseAccessToken verifies a JWT access token and checks that it has not
+// been revoked.
+func (app *application) parseAccessToken(rawToken string) (*data.Claims, error) {
+	claims, err := app.models.Tokens.ParseAccessToken(rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	if app.models.Revocations.IsRevoked(claims.ID, claims.SessionID, userID, claims.IssuedAtTime()) {
+		return nil, errInvalidAccessToken
+	}
+
+	return claims, nil
+}
+
+// rejectInactiveUser writes an error response and returns true unless the
+// user's status allows them to authenticate. Deleted users are told their
+// credentials are invalid so their former account is not revealed.
+func (app *application) rejectInactiveUser(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	switch user.Status {
+	case data.StatusActive:
+		return false
+	case data.StatusPending:
+		helpers.InactiveAccountResponse(w, r)
+	case data.StatusSuspended:
+		helpers.AccountSuspendedResponse(w, r)
+	default:
+		helpers.InvalidCredentialsResponse(w, r)
+	}
+	return true
+}
+
+func (app *application) RequireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			helpers.AuthenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission only lets through authenticated users whose role grants
+// the permission. It expects IsAuthorizedJWT to have run first.
+func (app *application) RequirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForRole(user.Role)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			helpers.NotPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.RequireAuthenticatedUser(fn)
+}
+
+// RequireOrgPermission only lets through members of the organization the
+// access token acts in whose role there grants the permission. Membership is
+// looked up on every request so a removed member loses access at once.
+func (app *application) RequireOrgPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		orgID := app.contextGetOrgID(r)
+		if orgID == 0 {
+			helpers.OrganizationRequiredResponse(w, r)
+			return
+		}
+
+		membership, err := app.models.Organizations.GetMembership(orgID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				helpers.NotPermittedResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForRole(membership.Role)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			helpers.NotPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.RequireAuthenticatedUser(fn)
+}
+
 func (app *application) CheckRefresh(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -88,7 +203,23 @@ func (app *application) CheckRefresh(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.TypeRefresh, rawToken)
+		token, err := app.models.Tokens.GetByPlaintext(data.TypeRefresh, rawToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				helpers.InvalidAuthenticationTokenResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if token.IsExposed {
+			app.revokeTokenFamily(w, r, token)
+			return
+		}
+
+		user, err := app.models.Users.GetByID(token.UserID)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -99,7 +230,12 @@ func (app *application) CheckRefresh(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		if app.rejectInactiveUser(w, r, user) {
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetRefreshToken(r, token)
 		next.ServeHTTP(w, r)
 
 	})
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+const (
+	hintAccessToken  = "access_token"
+	hintRefreshToken = "refresh_token"
+)
+
+// authenticateClient reads client credentials from HTTP Basic authentication
+// or, failing that, from the client_id and client_secret form fields.
+func (app *application) authenticateClient(r *http.Request) (*data.Client, error) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if id == "" {
+		return nil, data.ErrInvalidClient
+	}
+
+	return app.models.Clients.Authenticate(id, secret)
+}
+
+// Introspect implements RFC 7662 for both JWT access tokens and opaque refresh
+// tokens. Only confidential clients may introspect.
+func (app *application) Introspect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.OAuthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, err := app.authenticateClient(r)
+	if err != nil || client.IsPublic() {
+		switch {
+		case err == nil, errors.Is(err, data.ErrInvalidClient):
+			helpers.InvalidClientResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rawToken := r.PostForm.Get("token")
+	if rawToken == "" {
+		helpers.OAuthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "token must be provided")
+		return
+	}
+
+	lookups := []func(string) (helpers.Envelope, error){app.introspectAccessToken, app.introspectRefreshToken}
+	if r.PostForm.Get("token_type_hint") == hintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	response := helpers.Envelope{"active": false}
+	for _, lookup := range lookups {
+		env, err := lookup(rawToken)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+		if env != nil {
+			response = env
+			break
+		}
+	}
+
+	headers := http.Header{"Cache-Control": []string{"no-store"}}
+
+	err = helpers.WriteJSON(w, http.StatusOK, response, headers)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// introspectAccessToken returns nil if rawToken is not an active access token.
+func (app *application) introspectAccessToken(rawToken string) (helpers.Envelope, error) {
+	claims, err := app.parseAccessToken(rawToken)
+	if err != nil {
+		return nil, nil
+	}
+
+	userID, _ := claims.UserID()
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	env := helpers.Envelope{
+		"active":     true,
+		"token_type": hintAccessToken,
+		"sub":        claims.Subject,
+		"username":   user.Login,
+		"scope":      claims.Scope,
+		"exp":        claims.ExpiresAt,
+		"iat":        claims.IssuedAt,
+		"nbf":        claims.NotBefore,
+		"iss":        claims.Issuer,
+		"aud":        claims.Audience,
+		"jti":        claims.ID,
+	}
+	if claims.ClientID != "" {
+		env["client_id"] = claims.ClientID
+	}
+	if claims.OrgID != 0 {
+		env["org_id"] = claims.OrgID
+		env["org_role"] = claims.OrgRole
+	}
+	return env, nil
+}
+
+// introspectRefreshToken returns nil if rawToken is not an active refresh token.
+func (app *application) introspectRefreshToken(rawToken string) (helpers.Envelope, error) {
+	user, err := app.models.Users.GetForToken(data.TypeRefresh, rawToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	token, err := app.models.Tokens.GetByPlaintext(data.TypeRefresh, rawToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	env := helpers.Envelope{
+		"active":     true,
+		"token_type": hintRefreshToken,
+		"sub":        strconv.FormatInt(user.ID, 10),
+		"username":   user.Login,
+		"scope":      token.Scope,
+		"exp":        token.ExpiresAt.Unix(),
+	}
+
+	if token.FamilyID != "" {
+		session, err := app.models.Sessions.Get(token.FamilyID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return nil, nil
+			default:
+				return nil, err
+			}
+		}
+		if session.ClientID != "" {
+			env["client_id"] = session.ClientID
+		}
+		if session.OrgID != 0 {
+			env["org_id"] = session.OrgID
+		}
+	}
+	return env, nil
+}
+
+// Revoke implements RFC 7009. It revokes a single access token, or the session
+// behind a refresh token together with the access tokens issued for it. Public
+// clients may call it with their client_id alone.
+func (app *application) Revoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.OAuthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, err := app.authenticateClient(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidClient):
+			helpers.InvalidClientResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rawToken := r.PostForm.Get("token")
+	if rawToken == "" {
+		helpers.OAuthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "token must be provided")
+		return
+	}
+
+	revokers := []func(*data.Client, string) (bool, error){app.revokeAccessToken, app.revokeRefreshToken}
+	if r.PostForm.Get("token_type_hint") == hintRefreshToken {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		found, err := revoke(client, rawToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, errTokenClientMismatch):
+				helpers.OAuthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "the token was issued to another client")
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if found {
+			break
+		}
+	}
+
+	// Invalid and unknown tokens are not an error, the client cannot do
+	// anything about them anyway.
+	w.WriteHeader(http.StatusOK)
+}
+
+var errTokenClientMismatch = errors.New("token was issued to another client")
+
+// revokeAccessToken reports false if rawToken is not an active access token.
+func (app *application) revokeAccessToken(client *data.Client, rawToken string) (bool, error) {
+	claims, err := app.parseAccessToken(rawToken)
+	if err != nil {
+		return false, nil
+	}
+
+	if claims.ClientID != "" && claims.ClientID != client.ID {
+		return false, errTokenClientMismatch
+	}
+
+	err = app.models.Revocations.Revoke(data.RevokeToken, claims.ID, time.Until(claims.ExpiresAtTime()))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revokeRefreshToken reports false if rawToken is not a known refresh token.
+func (app *application) revokeRefreshToken(client *data.Client, rawToken string) (bool, error) {
+	token, err := app.models.Tokens.GetByPlaintext(data.TypeRefresh, rawToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	// Refresh tokens from before sessions existed have no session to end.
+	if token.FamilyID == "" {
+		return true, app.models.Tokens.Delete(token)
+	}
+
+	session, err := app.models.Sessions.Get(token.FamilyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	if session.ClientID != "" && session.ClientID != client.ID {
+		return false, errTokenClientMismatch
+	}
+
+	err = app.endSession(session.ID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
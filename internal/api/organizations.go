@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+// CreateOrganization creates an organization with the current user as its
+// admin.
+func (app *application) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	org := &data.Organization{Name: input.Name, Slug: input.Slug}
+
+	v := validator.New()
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.Insert(org, user.ID, data.RoleAdmin)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "an organization with this slug already exists")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"organization": org}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ListOrganizations returns the organizations the current user belongs to
+// and their role in each.
+func (app *application) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	memberships, err := app.models.Organizations.GetAllForUser(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"memberships": memberships}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ExchangeToken swaps the access token for one acting in another
+// organization, or in none when org_id is 0. The session follows, so tokens
+// refreshed later stay in the new organization. The old access token is
+// revoked.
+func (app *application) ExchangeToken(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	accessToken := app.contextGetAccessToken(r)
+
+	var input struct {
+		OrgID int64 `json:"org_id"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.OrgID >= 0, "org_id", "must not be negative")
+	v.Check(accessToken.SessionID != "", "token", "was issued before sessions existed, log in again")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, err := app.models.Sessions.Get(accessToken.SessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidAuthenticationTokenResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	session.OrgID = input.OrgID
+	session.OrgRole = ""
+
+	if input.OrgID != 0 {
+		membership, err := app.models.Organizations.GetMembership(input.OrgID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				helpers.NotPermittedResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		session.OrgRole = membership.Role
+	}
+
+	err = app.models.Sessions.SetOrg(session.ID, session.OrgID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.NewAccessToken(*user, session, app.config.jwt.accessTTL)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Revocations.Revoke(data.RevokeToken, accessToken.ID, time.Until(accessToken.ExpiresAtTime()))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	env := helpers.Envelope{
+		"authentication": helpers.Envelope{"access-token": token},
+		"org_id":         session.OrgID,
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) ListMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := app.models.Organizations.GetMembers(app.contextGetOrgID(r))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"members": members}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// RemoveMember takes a user out of the current organization and ends the
+// sessions they had acting in it, refresh tokens included.
+func (app *application) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	orgID := app.contextGetOrgID(r)
+
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		helpers.NotFoundResponse(w, r)
+		return
+	}
+
+	managed, err := app.managedWithout(orgID, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !managed {
+		v := validator.New()
+		v.AddError("member", "is the last member who can manage the organization")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.RemoveMember(orgID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.endOrgSessions(userID, orgID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "member removed"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// managedWithout reports whether some member of the organization other than
+// userID holds a role that grants members:write. Without one nobody could
+// invite or remove members again.
+func (app *application) managedWithout(orgID, userID int64) (bool, error) {
+	members, err := app.models.Organizations.GetMembers(orgID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, member := range members {
+		if member.UserID == userID {
+			continue
+		}
+
+		permissions, err := app.models.Permissions.GetAllForRole(member.Role)
+		if err != nil {
+			return false, err
+		}
+		if permissions.Include("members:write") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
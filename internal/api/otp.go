@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/binsabit/authorization_practice/internal/sender"
+)
+
+// otpRecipient says who a one-time passcode is for: exactly one of a phone
+// number, for a code by SMS, or an email address.
+type otpRecipient struct {
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+}
+
+func (rcpt otpRecipient) validate(v *validator.Validator) {
+	switch {
+	case rcpt.Phone != "" && rcpt.Email != "":
+		v.AddError("phone", "must not be given along with email")
+	case rcpt.Phone != "":
+		data.ValidatePhone(v, rcpt.Phone)
+	case rcpt.Email != "":
+		data.ValidateEmail(v, rcpt.Email)
+	default:
+		v.AddError("phone", "either phone or email must be provided")
+	}
+}
+
+func (rcpt otpRecipient) channel() string {
+	if rcpt.Phone != "" {
+		return sender.ChannelSMS
+	}
+	return sender.ChannelEmail
+}
+
+func (app *application) otpUser(rcpt otpRecipient) (*data.User, error) {
+	if rcpt.Phone != "" {
+		return app.models.Users.GetByPhone(rcpt.Phone)
+	}
+	return app.models.Users.GetByEmail(rcpt.Email)
+}
+
+// sendOTP issues a one-time passcode for purpose and sends it over channel.
+// It runs in the background, so it logs errors rather than returning them; a
+// code withheld for the resend cooldown or the limit on codes is not an
+// error.
+func (app *application) sendOTP(userID int64, purpose, channel, to string) {
+	code, err := app.models.OTP.Issue(userID, purpose, channel)
+	if err != nil {
+		if !errors.Is(err, data.ErrOTPCooldown) && !errors.Is(err, data.ErrOTPLimit) {
+			app.logger.Printf("issuing one-time passcode for user %d: %v", userID, err)
+		}
+		return
+	}
+
+	kind := "sign-in"
+	if purpose == data.OTPPurposeVerifyPhone {
+		kind = "verification"
+	}
+
+	err = app.sender.Send(sender.Message{
+		Channel: channel,
+		To:      to,
+		Body:    fmt.Sprintf("Your %s %s code is %s. It expires in %d minutes.", app.config.mfa.issuer, kind, code, int(data.OTPTTL.Minutes())),
+	})
+	if err != nil {
+		app.logger.Printf("sending one-time passcode to user %d: %v", userID, err)
+	}
+}
+
+// RequestOTP sends a one-time passcode to log in with by SMS, to a verified
+// phone number, or by email. Like
+// RequestPasswordReset it answers the same whether or not the recipient
+// belongs to a user, and does its work after responding, so a code withheld
+// because one was sent less than a cooldown ago goes unreported as well.
+func (app *application) RequestOTP(w http.ResponseWriter, r *http.Request) {
+	var input otpRecipient
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if input.validate(v); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.background(func() {
+		user, err := app.otpUser(input)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.Printf("looking up user for one-time passcode: %v", err)
+			}
+			return
+		}
+
+		if user.Status == data.StatusSuspended || user.Status == data.StatusDeleted {
+			return
+		}
+
+		channel := input.channel()
+		to := user.Email
+		if channel == sender.ChannelSMS {
+			to = user.Phone
+		}
+		app.sendOTP(user.ID, data.OTPPurposeLogin, channel, to)
+	})
+
+	env := helpers.Envelope{
+		"message":      "if an account with that phone number or email address exists, you will receive a sign-in code",
+		"resend_after": int(data.OTPResendCooldown.Seconds()),
+	}
+	err = helpers.WriteJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// LoginOTP exchanges a one-time passcode for a session, with the same
+// response as LoginUser. Users with two-factor authentication still have to
+// give a code from their authenticator.
+func (app *application) LoginOTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		otpRecipient
+		Code       string `json:"code"`
+		DeviceName string `json:"device_name"`
+		ClientID   string `json:"client_id"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	input.otpRecipient.validate(v)
+	v.Check(input.Code != "", "code", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.otpUser(input.otpRecipient)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidCredentialsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A locked out user gets the same answer as a wrong code, so the
+	// lockout does not give away that the account exists.
+	ok, err := app.models.OTP.Verify(user.ID, data.OTPPurposeLogin, input.Code)
+	if err != nil && !errors.Is(err, data.ErrOTPLocked) {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+
+	if app.rejectInactiveUser(w, r, user) {
+		return
+	}
+
+	mfaEnabled, err := app.models.TOTP.IsEnabled(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if mfaEnabled {
+		app.requireSecondFactor(w, r, user)
+		return
+	}
+
+	app.startSession(w, r, user, input.DeviceName, input.ClientID)
+}
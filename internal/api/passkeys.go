@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/binsabit/authorization_practice/internal/webauthn"
+	"github.com/julienschmidt/httprouter"
+)
+
+// webauthnConfig describes this service as a relying party. Passkeys log in
+// without a password, so the authenticator must verify the user itself with
+// a PIN or biometric, making the passkey a second factor on its own.
+func (app *application) webauthnConfig() webauthn.Config {
+	return webauthn.Config{
+		RPID:                    app.config.webauthn.rpID,
+		RPName:                  app.config.webauthn.rpName,
+		Origins:                 app.config.webauthn.origins,
+		RequireUserVerification: true,
+	}
+}
+
+// userHandle is the opaque ID authenticators store with a user's passkeys
+// and hand back when one is used: the user's ID as 8 big-endian bytes.
+func userHandle(userID int64) webauthn.Bytes {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// publicKeyCredential is the JSON PublicKeyCredential.toJSON() produces for
+// the result of a ceremony. Response holds the fields of whichever of the
+// two ceremonies it was. The fields that only repeat what the attestation
+// object says, or report extensions, are accepted and ignored.
+type publicKeyCredential struct {
+	ID                      string          `json:"id"`
+	RawID                   webauthn.Bytes  `json:"rawId"`
+	Type                    string          `json:"type"`
+	AuthenticatorAttachment string          `json:"authenticatorAttachment"`
+	ClientExtensionResults  json.RawMessage `json:"clientExtensionResults"`
+	Response                struct {
+		ClientDataJSON     webauthn.Bytes `json:"clientDataJSON"`
+		AttestationObject  webauthn.Bytes `json:"attestationObject"`
+		Transports         []string       `json:"transports"`
+		PublicKey          webauthn.Bytes `json:"publicKey"`
+		PublicKeyAlgorithm int64          `json:"publicKeyAlgorithm"`
+		AuthenticatorData  webauthn.Bytes `json:"authenticatorData"`
+		Signature          webauthn.Bytes `json:"signature"`
+		UserHandle         webauthn.Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+func validatePublicKeyCredential(v *validator.Validator, cred *publicKeyCredential) {
+	v.Check(cred.Type == "public-key", "credential.type", "must be public-key")
+	v.Check(len(cred.RawID) > 0, "credential.rawId", "must be provided")
+	v.Check(len(cred.Response.ClientDataJSON) > 0, "credential.response.clientDataJSON", "must be provided")
+}
+
+// consumeCeremony finds the challenge a ceremony's client data names and
+// uses it up, returning the challenge and the user it was issued to.
+func (app *application) consumeCeremony(cred *publicKeyCredential, ceremony string) (webauthn.Bytes, int64, error) {
+	_, challenge, err := webauthn.ParseClientData(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userID, err := app.models.WebAuthn.ConsumeChallenge(challenge, ceremony)
+	if err != nil {
+		return nil, 0, err
+	}
+	return challenge, userID, nil
+}
+
+// BeginPasskeyRegistration returns the options to pass to
+// navigator.credentials.create() to register a passkey for the current user.
+// A passkey logs in for good, so it takes the password and, with two-factor
+// authentication, a code or recovery code: a stolen access token alone must
+// not be enough to add one. RegisterPasskey only accepts a credential that
+// answers a challenge issued here.
+func (app *application) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	creds, err := app.models.WebAuthn.GetAllForUser(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	exclude := make([]webauthn.CredentialDescriptor, len(creds))
+	for i, cred := range creds {
+		exclude[i] = cred.Descriptor()
+	}
+
+	challenge, err := app.models.WebAuthn.NewChallenge(user.ID, data.CeremonyRegistration)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Login
+	}
+
+	options := app.webauthnConfig().CreationOptions(challenge, webauthn.User{
+		ID:          userHandle(user.ID),
+		Name:        user.Login,
+		DisplayName: displayName,
+	}, exclude)
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"publicKey": options}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// RegisterPasskey verifies the credential navigator.credentials.create()
+// produced and stores it for the current user.
+func (app *application) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name       string              `json:"name"`
+		Credential publicKeyCredential `json:"credential"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Name) <= 100, "name", "must not be more than 100 bytes long")
+	validatePublicKeyCredential(v, &input.Credential)
+	v.Check(len(input.Credential.Response.AttestationObject) > 0, "credential.response.attestationObject", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	challenge, userID, err := app.consumeCeremony(&input.Credential, data.CeremonyRegistration)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) && !errors.Is(err, webauthn.ErrVerification) {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+	if err != nil || userID != user.ID {
+		v.AddError("credential", "does not answer a current registration challenge")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	verified, err := app.webauthnConfig().VerifyRegistration(challenge, input.Credential.Response.ClientDataJSON, input.Credential.Response.AttestationObject)
+	if err != nil {
+		v.AddError("credential", err.Error())
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !bytes.Equal(verified.ID, input.Credential.RawID) {
+		v.AddError("credential.rawId", "does not match the attested credential")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transports := input.Credential.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	cred := &data.WebAuthnCredential{
+		ID:              verified.ID,
+		UserID:          user.ID,
+		Name:            input.Name,
+		PublicKey:       verified.PublicKey,
+		SignCount:       verified.SignCount,
+		AAGUID:          verified.AAGUID,
+		AttestationType: verified.AttestationType,
+		Transports:      transports,
+	}
+
+	err = app.models.WebAuthn.Insert(cred)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredential):
+			v.AddError("credential", "is already registered")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"passkey": cred}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	creds, err := app.models.WebAuthn.GetAllForUser(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"passkeys": creds}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := webauthn.DecodeBytes(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		helpers.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.WebAuthn.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "passkey deleted"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// BeginPasskeyLogin returns the options to pass to
+// navigator.credentials.get(). Given a login, only that user's passkeys are
+// offered; without one the user picks any passkey they have for this site.
+func (app *application) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Login string `json:"login"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var userID int64
+	var allow []webauthn.CredentialDescriptor
+
+	if input.Login != "" {
+		user, err := app.models.Users.GetByLogin(input.Login)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				helpers.InvalidCredentialsResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		creds, err := app.models.WebAuthn.GetAllForUser(user.ID)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+		if len(creds) == 0 {
+			helpers.InvalidCredentialsResponse(w, r)
+			return
+		}
+
+		userID = user.ID
+		for _, cred := range creds {
+			allow = append(allow, cred.Descriptor())
+		}
+	}
+
+	challenge, err := app.models.WebAuthn.NewChallenge(userID, data.CeremonyLogin)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	options := app.webauthnConfig().RequestOptions(challenge, allow)
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"publicKey": options}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// LoginPasskey verifies the assertion navigator.credentials.get() produced
+// and signs the passkey's owner in, with the same response as LoginUser.
+func (app *application) LoginPasskey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Credential publicKeyCredential `json:"credential"`
+		DeviceName string              `json:"device_name"`
+		ClientID   string              `json:"client_id"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	validatePublicKeyCredential(v, &input.Credential)
+	v.Check(len(input.Credential.Response.AuthenticatorData) > 0, "credential.response.authenticatorData", "must be provided")
+	v.Check(len(input.Credential.Response.Signature) > 0, "credential.response.signature", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	challenge, userID, err := app.consumeCeremony(&input.Credential, data.CeremonyLogin)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound), errors.Is(err, webauthn.ErrVerification):
+			helpers.InvalidCredentialsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cred, err := app.models.WebAuthn.Get(input.Credential.RawID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.InvalidCredentialsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A challenge issued for a named user only admits their passkeys, and
+	// a discoverable passkey has to name the user it belongs to.
+	if userID != 0 && userID != cred.UserID {
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+	handle := input.Credential.Response.UserHandle
+	if len(handle) > 0 && !bytes.Equal(handle, userHandle(cred.UserID)) {
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+
+	signCount, err := app.webauthnConfig().VerifyAssertion(challenge, cred.PublicKey, cred.SignCount, webauthn.Assertion{
+		ClientDataJSON:    input.Credential.Response.ClientDataJSON,
+		AuthenticatorData: input.Credential.Response.AuthenticatorData,
+		Signature:         input.Credential.Response.Signature,
+	})
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			app.logger.Printf("passkey %s of user %d may be cloned: %v", cred.ID, cred.UserID, err)
+		}
+		helpers.InvalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.WebAuthn.RecordUse(cred, signCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.InvalidCredentialsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.GetByID(cred.UserID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if app.rejectInactiveUser(w, r, user) {
+		return
+	}
+
+	app.startSession(w, r, user, input.DeviceName, input.ClientID)
+}
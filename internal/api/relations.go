@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+)
+
+// readTuples parses the tuples of a write or delete request, recording a
+// validation error for each one that does not parse.
+func readTuples(v *validator.Validator, raw []string) []data.Tuple {
+	v.Check(len(raw) > 0, "tuples", "must be provided")
+	v.Check(len(raw) <= 100, "tuples", "must not contain more than 100 tuples")
+
+	tuples := make([]data.Tuple, 0, len(raw))
+	for _, s := range raw {
+		t, err := data.ParseTuple(s)
+		if err != nil {
+			v.AddError("tuples", "must be written as namespace:id#relation@subject, got "+s)
+			continue
+		}
+		tuples = append(tuples, t)
+	}
+	return tuples
+}
+
+// relationErrorResponse reports tuples and queries that name undefined
+// namespaces or relations as validation errors.
+func relationErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, key string, err error) {
+	switch {
+	case errors.Is(err, data.ErrUnknownNamespace), errors.Is(err, data.ErrUnknownRelation):
+		v.AddError(key, err.Error())
+		helpers.FailedValidationResponse(w, r, v.Errors)
+	default:
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) WriteRelations(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tuples []string `json:"tuples"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	tuples := readTuples(v, input.Tuples)
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Relations.Write(app.contextGetOrgID(r), tuples)
+	if err != nil {
+		relationErrorResponse(w, r, v, "tuples", err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"tuples": input.Tuples}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) DeleteRelations(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tuples []string `json:"tuples"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	tuples := readTuples(v, input.Tuples)
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Relations.Delete(app.contextGetOrgID(r), tuples)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "tuples deleted"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// CheckRelation answers whether the tuple holds, either because it was
+// written or because the namespace config derives it.
+func (app *application) CheckRelation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tuple string `json:"tuple"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	t, err := data.ParseTuple(input.Tuple)
+	if err != nil {
+		v.AddError("tuple", "must be written as namespace:id#relation@subject")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	allowed, err := app.models.Relations.Check(app.contextGetOrgID(r), t.Namespace, t.ObjectID, t.Relation, t.Subject)
+	if err != nil {
+		relationErrorResponse(w, r, v, "tuple", err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"allowed": allowed}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ExpandRelation returns the tree of subjects that have a relation to an
+// object, given as ?object=document:42&relation=viewer.
+func (app *application) ExpandRelation(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	object, err := data.ParseSubject(qs.Get("object"))
+	if err != nil || object.Relation != "" {
+		v.AddError("object", "must be written as namespace:id")
+	}
+	v.Check(qs.Get("relation") != "", "relation", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tree, err := app.models.Relations.Expand(app.contextGetOrgID(r), object.Namespace, object.ID, qs.Get("relation"))
+	if err != nil {
+		relationErrorResponse(w, r, v, "relation", err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"tree": tree}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ListRelationObjects returns the objects of a namespace the subject has a
+// relation to, given as ?namespace=document&relation=viewer&subject=user:7.
+func (app *application) ListRelationObjects(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	subject, err := data.ParseSubject(qs.Get("subject"))
+	if err != nil {
+		v.AddError("subject", "must be written as namespace:id or namespace:id#relation")
+	}
+	v.Check(qs.Get("namespace") != "", "namespace", "must be provided")
+	v.Check(qs.Get("relation") != "", "relation", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	objects, err := app.models.Relations.ListObjects(app.contextGetOrgID(r), qs.Get("namespace"), qs.Get("relation"), subject)
+	if err != nil {
+		relationErrorResponse(w, r, v, "relation", err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"objects": objects}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ShowRole returns a role as stored, along with the permissions it ends up
+// with once its ancestors are taken into account.
+func (app *application) ShowRole(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	role, err := app.models.Roles.Get(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	effective, err := app.models.Permissions.GetAllForRole(role.Name)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"role": role, "effective_permissions": effective}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// SaveRole creates a role or replaces its description, parents and direct
+// permissions.
+func (app *application) SaveRole(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Description string   `json:"description"`
+		Parents     []string `json:"parents"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	role := &data.Role{
+		Name:        httprouter.ParamsFromContext(r.Context()).ByName("name"),
+		Description: input.Description,
+		Parents:     input.Parents,
+		Permissions: input.Permissions,
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, role); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Roles.Save(role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownRole):
+			v.AddError("parents", "must only name existing roles")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRoleCycle):
+			v.AddError("parents", "must not make the role inherit from itself")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownPermission):
+			v.AddError("permissions", "must only name existing permissions")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"role": role}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -11,9 +12,61 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/", app.IsAuthorizedJWT(app.Index))
 	router.HandlerFunc(http.MethodPost, "/auth/register", app.RegisterUser)
+	router.HandlerFunc(http.MethodPut, "/auth/activate", app.ActivateUser)
 	router.HandlerFunc(http.MethodPost, "/auth/login", app.LoginUser)
+	router.HandlerFunc(http.MethodPost, "/auth/login/totp", app.LoginTOTP)
+	router.HandlerFunc(http.MethodPost, "/auth/login/passkey/challenge", app.BeginPasskeyLogin)
+	router.HandlerFunc(http.MethodPost, "/auth/login/passkey", app.LoginPasskey)
+	router.HandlerFunc(http.MethodPost, "/auth/magic-link", app.RequestMagicLink)
+	router.HandlerFunc(http.MethodGet, "/auth/magic-link/verify", app.VerifyMagicLink)
+	router.HandlerFunc(http.MethodPost, "/auth/otp", app.RequestOTP)
+	router.HandlerFunc(http.MethodPost, "/auth/otp/verify", app.LoginOTP)
+	router.HandlerFunc(http.MethodPost, "/auth/password-reset", app.RequestPasswordReset)
+	router.HandlerFunc(http.MethodPut, "/auth/password", app.ResetPassword)
 	router.HandlerFunc(http.MethodGet, "/auth/logout", app.IsAuthorizedJWT(app.LogoutUser))
 	router.HandlerFunc(http.MethodGet, "/auth/refresh", app.CheckRefresh(app.RefreshSession))
+	router.HandlerFunc(http.MethodPost, "/auth/token-exchange", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ExchangeToken)))
+	router.HandlerFunc(http.MethodGet, "/auth/sessions", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ListSessions)))
+	router.HandlerFunc(http.MethodDelete, "/auth/sessions", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.DeleteOtherSessions)))
+	router.HandlerFunc(http.MethodDelete, "/auth/sessions/:id", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.DeleteSession)))
+	router.HandlerFunc(http.MethodGet, "/users/me", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ShowCurrentUser)))
+	router.HandlerFunc(http.MethodPatch, "/users/me", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.UpdateCurrentUser)))
+	router.HandlerFunc(http.MethodPut, "/users/me/password", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ChangePassword)))
+	router.HandlerFunc(http.MethodPut, "/users/me/phone", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ChangePhone)))
+	router.HandlerFunc(http.MethodPost, "/users/me/phone/verify", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.VerifyPhone)))
+	router.HandlerFunc(http.MethodPost, "/users/me/mfa/totp", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.EnrollTOTP)))
+	router.HandlerFunc(http.MethodPost, "/users/me/mfa/totp/confirm", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ConfirmTOTP)))
+	router.HandlerFunc(http.MethodDelete, "/users/me/mfa/totp", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.DisableTOTP)))
+	router.HandlerFunc(http.MethodGet, "/users/me/mfa/recovery-codes", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ShowRecoveryCodes)))
+	router.HandlerFunc(http.MethodPost, "/users/me/mfa/recovery-codes", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.RegenerateRecoveryCodes)))
+	router.HandlerFunc(http.MethodGet, "/users/me/passkeys", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ListPasskeys)))
+	router.HandlerFunc(http.MethodPost, "/users/me/passkeys/challenge", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.BeginPasskeyRegistration)))
+	router.HandlerFunc(http.MethodPost, "/users/me/passkeys", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.RegisterPasskey)))
+	router.HandlerFunc(http.MethodDelete, "/users/me/passkeys/:id", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.DeletePasskey)))
+	router.HandlerFunc(http.MethodGet, "/orgs", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.ListOrganizations)))
+	router.HandlerFunc(http.MethodPost, "/orgs", app.IsAuthorizedJWT(app.RequireAuthenticatedUser(app.CreateOrganization)))
+	router.HandlerFunc(http.MethodGet, "/orgs/members", app.IsAuthorizedJWT(app.RequireOrgPermission("members:read", app.ListMembers)))
+	router.HandlerFunc(http.MethodDelete, "/orgs/members/:id", app.IsAuthorizedJWT(app.RequireOrgPermission("members:write", app.RemoveMember)))
+	router.HandlerFunc(http.MethodGet, "/orgs/invitations", app.IsAuthorizedJWT(app.RequireOrgPermission("members:read", app.ListInvitations)))
+	router.HandlerFunc(http.MethodPost, "/orgs/invitations", app.IsAuthorizedJWT(app.RequireOrgPermission("members:write", app.InviteMember)))
+	router.HandlerFunc(http.MethodPost, "/orgs/invitations/:id/resend", app.IsAuthorizedJWT(app.RequireOrgPermission("members:write", app.ResendInvitation)))
+	router.HandlerFunc(http.MethodDelete, "/orgs/invitations/:id", app.IsAuthorizedJWT(app.RequireOrgPermission("members:write", app.CancelInvitation)))
+	router.HandlerFunc(http.MethodPost, "/invitations/accept", app.IsAuthorizedJWT(app.AcceptInvitation))
+	router.HandlerFunc(http.MethodGet, "/admin/users/:id", app.IsAuthorizedJWT(app.RequirePermission("users:read", app.ShowUser)))
+	router.HandlerFunc(http.MethodPut, "/admin/users/:id/status", app.IsAuthorizedJWT(app.RequirePermission("users:write", app.UpdateUserStatus)))
+	router.HandlerFunc(http.MethodPut, "/admin/users/:id/role", app.IsAuthorizedJWT(app.RequirePermission("users:write", app.UpdateUserRole)))
+	router.HandlerFunc(http.MethodGet, "/admin/roles/:name", app.IsAuthorizedJWT(app.RequirePermission("roles:read", app.ShowRole)))
+	router.HandlerFunc(http.MethodPut, "/admin/roles/:name", app.IsAuthorizedJWT(app.RequirePermission("roles:write", app.SaveRole)))
+	router.HandlerFunc(http.MethodPost, "/admin/authz/explain", app.IsAuthorizedJWT(app.RequirePermission("policies:explain", app.ExplainDecision)))
+	router.HandlerFunc(http.MethodPost, "/relations", app.IsAuthorizedJWT(app.RequireOrgPermission("relations:write", app.WriteRelations)))
+	router.HandlerFunc(http.MethodDelete, "/relations", app.IsAuthorizedJWT(app.RequireOrgPermission("relations:write", app.DeleteRelations)))
+	router.HandlerFunc(http.MethodPost, "/relations/check", app.IsAuthorizedJWT(app.RequireOrgPermission("relations:read", app.CheckRelation)))
+	router.HandlerFunc(http.MethodGet, "/relations/expand", app.IsAuthorizedJWT(app.RequireOrgPermission("relations:read", app.ExpandRelation)))
+	router.HandlerFunc(http.MethodGet, "/relations/objects", app.IsAuthorizedJWT(app.RequireOrgPermission("relations:read", app.ListRelationObjects)))
+	router.HandlerFunc(http.MethodPost, "/oauth/introspect", app.Introspect)
+	router.HandlerFunc(http.MethodPost, "/oauth/revoke", app.Revoke)
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.JWKS)
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.IsAuthorizedJWT(app.RequirePermission("metrics:read", expvar.Handler().ServeHTTP)))
 
 	return router
 }
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Sessions.GetAllForUser(user.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	current := app.contextGetSessionID(r)
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"sessions": sessions}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	err := app.models.Sessions.DeleteForUser(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Revocations.RevokeSession(id)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "session revoked"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// DeleteOtherSessions logs the user out everywhere except the device making
+// the request.
+func (app *application) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.endOtherSessions(user.ID, app.contextGetSessionID(r))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "other sessions revoked"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// endSession deletes a session with its refresh tokens and revokes the access
+// tokens that were issued for it.
+func (app *application) endSession(sessionID string) error {
+	err := app.models.Sessions.Delete(sessionID)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Revocations.RevokeSession(sessionID)
+}
+
+// endOtherSessions ends every session of the user except current.
+func (app *application) endOtherSessions(userID int64, current string) error {
+	sessions, err := app.models.Sessions.GetAllForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Sessions.DeleteAllForUser(userID, current)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == current {
+			continue
+		}
+		err = app.models.Revocations.RevokeSession(session.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endOrgSessions ends the sessions a user has acting in an organization,
+// for when they leave it.
+func (app *application) endOrgSessions(userID, orgID int64) error {
+	ids, err := app.models.Sessions.DeleteAllForOrg(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err = app.models.Revocations.RevokeSession(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endAllSessions signs the user out on every device, revoking refresh tokens
+// and every access token issued so far.
+func (app *application) endAllSessions(userID int64) error {
+	err := app.models.Sessions.DeleteAllForUser(userID, "")
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.TypeRefresh, userID)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Revocations.RevokeUser(userID)
+}
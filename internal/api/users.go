@@ -0,0 +1,416 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/helpers"
+	"github.com/binsabit/authorization_practice/internal/sender"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) ShowCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// UpdateCurrentUser changes profile fields. Clients may send the version they
+// last saw to make sure they are not overwriting someone else's edit. The
+// phone number is changed with ChangePhone instead.
+func (app *application) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name    *string `json:"name"`
+		Version *int    `json:"version"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Version != nil && *input.Version != user.Version {
+		helpers.EditConflictResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	v := validator.New()
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ChangePassword sets a new password after checking the current one, then
+// signs the user out on their other devices.
+func (app *application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	data.ValidatePasswordPlaintext(v, input.NewPassword)
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	matched, _ := user.Password.Matches(input.CurrentPassword)
+	if !matched {
+		v.AddError("current_password", "is incorrect")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.NewPassword)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.endOtherSessions(user.ID, app.contextGetSessionID(r))
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "your password was successfully changed"}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ChangePhone sets the phone number one-time passcodes can be sent to, or
+// removes it if phone is empty. Like DisableTOTP it takes the password, and
+// a code or recovery code with two-factor authentication, so a stolen access
+// token cannot put the thief's number on the account. The new number is
+// sent a code and cannot be used to log in until VerifyPhone sees it; giving
+// the same unverified number again sends another.
+func (app *application) ChangePhone(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Phone        string `json:"phone"`
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	if input.Phone != "" {
+		data.ValidatePhone(v, input.Phone)
+	}
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	phone := data.NormalizePhone(input.Phone)
+	if phone != user.Phone {
+		user.Phone = phone
+		user.PhoneVerified = false
+
+		err = app.models.Users.Update(user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				helpers.EditConflictResponse(w, r)
+			default:
+				helpers.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// A code sent to the previous number must not verify this one.
+		err = app.models.OTP.Delete(user.ID, data.OTPPurposeVerifyPhone)
+		if err != nil {
+			helpers.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if user.Phone != "" && !user.PhoneVerified {
+		userID := user.ID
+		app.background(func() {
+			app.sendOTP(userID, data.OTPPurposeVerifyPhone, sender.ChannelSMS, phone)
+		})
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// VerifyPhone marks the user's phone number verified with the code
+// ChangePhone sent to it, after which it can be used to log in.
+func (app *application) VerifyPhone(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(user.Phone != "" && !user.PhoneVerified, "phone", "there is no phone number waiting to be verified")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.models.OTP.Verify(user.ID, data.OTPPurposeVerifyPhone, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOTPLocked):
+			helpers.TooManyAttemptsResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		v.AddError("code", "is invalid or expired")
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.PhoneVerified = true
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicatePhone):
+			v.AddError("phone", "is already verified for another account")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+// setUserStatus moves a user through the status lifecycle. Suspending or
+// deleting a user signs them out everywhere straight away.
+func (app *application) setUserStatus(user *data.User, status string) error {
+	err := user.TransitionTo(status)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+
+	if !user.IsActive() {
+		return app.endAllSessions(user.ID)
+	}
+	return nil
+}
+
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// getUserParam loads the user named in the URL, writing the error response
+// itself when that fails.
+func (app *application) getUserParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		helpers.NotFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			helpers.NotFoundResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) ShowUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.setUserStatus(user, input.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			v := validator.New()
+			v.AddError("status", err.Error())
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Role != "", "role", "must be provided")
+
+	if !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Role = input.Role
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownRole):
+			v.AddError("role", "does not exist")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			helpers.EditConflictResponse(w, r)
+		default:
+			helpers.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		helpers.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,120 @@
+package authz
+
+import (
+	"encoding/json"
+	"strings"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+)
+
+// Attributes are the facts a policy condition can refer to. Values are
+// strings, numbers, booleans, lists of those, or nested Attributes.
+type Attributes map[string]interface{}
+
+// Subject is whoever is asking to act.
+type Subject struct {
+	Attributes Attributes
+}
+
+// SubjectFromUser exposes a user's attributes to policies as subject.id,
+// subject.login, subject.email, subject.name, subject.role and
+// subject.status. extra adds attributes kept outside the users table, such
+// as the teams a user belongs to, and may be nil. extra cannot override the
+// attributes taken from the user.
+func SubjectFromUser(user *data.User, extra Attributes) Subject {
+	attrs := make(Attributes, len(extra)+6)
+	for k, v := range extra {
+		attrs[k] = v
+	}
+	attrs["id"] = user.ID
+	attrs["login"] = user.Login
+	attrs["email"] = user.Email
+	attrs["name"] = user.Name
+	attrs["role"] = user.Role
+	attrs["status"] = user.Status
+	return Subject{Attributes: attrs}
+}
+
+// Resource is what the subject wants to act on. Its type and id are visible
+// to policies as resource.type and resource.id next to its attributes.
+type Resource struct {
+	Type       string     `json:"type"`
+	ID         string     `json:"id"`
+	Attributes Attributes `json:"attributes"`
+}
+
+func (r Resource) attributes() Attributes {
+	attrs := make(Attributes, len(r.Attributes)+2)
+	for k, v := range r.Attributes {
+		attrs[k] = v
+	}
+	attrs["type"] = r.Type
+	attrs["id"] = r.ID
+	return attrs
+}
+
+// lookup resolves a dotted path such as "subject.teams" or
+// "resource.owner.id" against nested attributes.
+func (a Attributes) lookup(path string) (interface{}, bool) {
+	var value interface{} = a
+	for _, part := range strings.Split(path, ".") {
+		var m map[string]interface{}
+		switch v := value.(type) {
+		case Attributes:
+			m = v
+		case map[string]interface{}:
+			m = v
+		default:
+			return nil, false
+		}
+
+		next, ok := m[part]
+		if !ok {
+			return nil, false
+		}
+		value = next
+	}
+	return value, true
+}
+
+// normalize brings the numeric and list types callers and the JSON decoder
+// produce to float64 and []interface{}, so values compare regardless of how
+// they were built.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case []string:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		return list
+	case []int64:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = float64(v[i])
+		}
+		return list
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = normalize(v[i])
+		}
+		return list
+	default:
+		return v
+	}
+}
@@ -0,0 +1,259 @@
+// Package authz decides whether a subject may perform an action on a
+// resource by evaluating declarative policies against their attributes and
+// the context of the request.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDenied = errors.New("not authorized")
+)
+
+// Options configures an Engine.
+type Options struct {
+	// Location is the time zone of the hour and weekday context attributes.
+	// It defaults to UTC.
+	Location *time.Location
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// Engine evaluates the policies stored in a directory, one or more per JSON
+// file. A request is allowed when at least one allow policy matches and no
+// deny policy does; anything else is denied.
+type Engine struct {
+	dir  string
+	opts Options
+
+	mu       sync.RWMutex
+	policies []*Policy
+}
+
+// Open loads the policies in dir. A missing directory holds no policies, so
+// every request is denied.
+func Open(dir string, opts Options) (*Engine, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	e := &Engine{dir: dir, opts: opts}
+
+	err := e.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload rereads the policy files. The policies in use are only replaced if
+// every file parses, so a bad edit cannot leave the engine half loaded.
+func (e *Engine) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(e.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var policies []*Policy
+	ids := make(map[string]string)
+
+	for _, path := range paths {
+		filePolicies, err := readPolicies(path)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range filePolicies {
+			if other, ok := ids[p.ID]; ok {
+				return fmt.Errorf("%s: policy %s is already defined in %s", path, p.ID, other)
+			}
+			ids[p.ID] = path
+		}
+		policies = append(policies, filePolicies...)
+	}
+
+	e.mu.Lock()
+	e.policies = policies
+	e.mu.Unlock()
+
+	return nil
+}
+
+func readPolicies(path string) ([]*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file struct {
+		Policies []*Policy `json:"policies"`
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, p := range file.Policies {
+		err = p.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return file.Policies, nil
+}
+
+// Len returns the number of policies loaded.
+func (e *Engine) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.policies)
+}
+
+type contextKey string
+
+const attributesContextKey = contextKey("authz")
+
+// WithContext attaches request attributes, such as the client IP, that
+// policies can refer to as $context.<name>.
+func WithContext(ctx context.Context, attrs Attributes) context.Context {
+	return context.WithValue(ctx, attributesContextKey, attrs)
+}
+
+// Step records how one policy took part in a decision.
+type Step struct {
+	Policy string `json:"policy"`
+	Effect string `json:"effect"`
+	// Matched is true when the policy applied to the request and its
+	// condition held.
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// Decision is the outcome of Authorize along with the trace that led to it.
+type Decision struct {
+	Allowed  bool     `json:"allowed"`
+	Action   string   `json:"action"`
+	Resource Resource `json:"resource"`
+	// Policy is the policy that decided, empty when the request was denied
+	// because nothing allowed it.
+	Policy string `json:"policy,omitempty"`
+	Trace  []Step `json:"trace"`
+}
+
+// Explain renders the decision and its trace for logs and debugging.
+func (d Decision) Explain() string {
+	var b strings.Builder
+
+	outcome := "denied"
+	if d.Allowed {
+		outcome = "allowed"
+	}
+	fmt.Fprintf(&b, "%s %s on %s %q", outcome, d.Action, d.Resource.Type, d.Resource.ID)
+
+	switch {
+	case d.Policy != "":
+		fmt.Fprintf(&b, " by policy %s", d.Policy)
+	case !d.Allowed:
+		b.WriteString(": no policy allows it")
+	}
+
+	for _, step := range d.Trace {
+		fmt.Fprintf(&b, "\n  %s (%s): %s", step.Policy, step.Effect, step.Reason)
+	}
+	return b.String()
+}
+
+// Authorize decides whether subject may perform action on resource. It
+// returns ErrDenied when it may not; the decision is returned either way so
+// the caller can log or show why.
+func (e *Engine) Authorize(ctx context.Context, subject Subject, action string, resource Resource) (Decision, error) {
+	env := Attributes{
+		"subject":  subject.Attributes,
+		"resource": resource.attributes(),
+		"action":   action,
+		"context":  e.contextAttributes(ctx),
+	}
+
+	decision := Decision{Action: action, Resource: resource}
+	var allowedBy string
+
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+
+	for _, p := range policies {
+		step := Step{Policy: p.ID, Effect: p.Effect}
+
+		switch {
+		case !p.appliesTo(action, resource.Type):
+			step.Reason = "does not apply"
+		case p.Condition == nil:
+			step.Matched = true
+			step.Reason = "matched"
+		default:
+			ok, why := p.Condition.evaluate(env)
+			step.Matched = ok
+			step.Reason = "matched"
+			if !ok {
+				step.Reason = why
+			}
+		}
+
+		decision.Trace = append(decision.Trace, step)
+
+		if !step.Matched {
+			continue
+		}
+		if p.Effect == EffectDeny {
+			decision.Policy = p.ID
+			return decision, ErrDenied
+		}
+		if allowedBy == "" {
+			allowedBy = p.ID
+		}
+	}
+
+	if allowedBy == "" {
+		return decision, ErrDenied
+	}
+
+	decision.Allowed = true
+	decision.Policy = allowedBy
+	return decision, nil
+}
+
+// contextAttributes adds the time of the request to the attributes attached
+// with WithContext, which cannot override it.
+func (e *Engine) contextAttributes(ctx context.Context) Attributes {
+	now := e.opts.Now().In(e.opts.Location)
+
+	attrs := Attributes{}
+	if extra, ok := ctx.Value(attributesContextKey).(Attributes); ok {
+		for k, v := range extra {
+			attrs[k] = v
+		}
+	}
+
+	attrs["time"] = now.Format(time.RFC3339)
+	attrs["hour"] = now.Hour()
+	attrs["weekday"] = strings.ToLower(now.Weekday().String())
+	return attrs
+}
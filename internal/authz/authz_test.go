@@ -0,0 +1,234 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	data "github.com/binsabit/authorization_practice/internal/data/models"
+)
+
+const testPolicies = `{
+	"policies": [
+		{
+			"id": "edit-owner-or-team",
+			"effect": "allow",
+			"actions": ["documents:edit"],
+			"resources": ["document"],
+			"condition": {
+				"all": [
+					{"any": [
+						{"eq": ["$subject.id", "$resource.owner_id"]},
+						{"in": ["$resource.team", "$subject.teams"]}
+					]},
+					{"between": ["$context.hour", 9, 18]}
+				]
+			}
+		},
+		{
+			"id": "read-any",
+			"effect": "allow",
+			"actions": ["documents:read"],
+			"resources": ["document"],
+			"condition": {"not": {"eq": ["$resource.private", true]}}
+		},
+		{
+			"id": "locked",
+			"effect": "deny",
+			"actions": ["documents:edit"],
+			"condition": {"eq": ["$resource.locked", true]}
+		},
+		{
+			"id": "inactive-users",
+			"effect": "deny",
+			"actions": ["*"],
+			"condition": {"ne": ["$subject.status", "active"]}
+		}
+	]
+}`
+
+func openTestEngine(t *testing.T, now time.Time) *Engine {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policies.json"), []byte(testPolicies), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Open(dir, Options{Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestAuthorize(t *testing.T) {
+	workday := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC)
+
+	owner := &data.User{ID: 7, Status: data.StatusActive, Role: data.RoleUser}
+	teammate := &data.User{ID: 8, Status: data.StatusActive, Role: data.RoleUser}
+	stranger := &data.User{ID: 9, Status: data.StatusActive, Role: data.RoleUser}
+	suspended := &data.User{ID: 7, Status: data.StatusSuspended, Role: data.RoleUser}
+
+	doc := Resource{Type: "document", ID: "42", Attributes: Attributes{"owner_id": 7, "team": "eng"}}
+	locked := Resource{Type: "document", ID: "43", Attributes: Attributes{"owner_id": 7, "locked": true}}
+	private := Resource{Type: "document", ID: "44", Attributes: Attributes{"owner_id": 7, "private": true}}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		subject  Subject
+		action   string
+		resource Resource
+		allowed  bool
+		policy   string
+	}{
+		{"owner edits", workday, SubjectFromUser(owner, nil), "documents:edit", doc, true, "edit-owner-or-team"},
+		{"team member edits", workday, SubjectFromUser(teammate, Attributes{"teams": []string{"eng"}}), "documents:edit", doc, true, "edit-owner-or-team"},
+		{"stranger edits", workday, SubjectFromUser(stranger, Attributes{"teams": []string{"ops"}}), "documents:edit", doc, false, ""},
+		{"owner edits at night", night, SubjectFromUser(owner, nil), "documents:edit", doc, false, ""},
+		{"stranger reads", night, SubjectFromUser(stranger, nil), "documents:read", doc, true, "read-any"},
+		{"stranger reads private", night, SubjectFromUser(stranger, nil), "documents:read", private, false, ""},
+		{"owner edits locked", workday, SubjectFromUser(owner, nil), "documents:edit", locked, false, "locked"},
+		{"suspended owner reads", workday, SubjectFromUser(suspended, nil), "documents:read", doc, false, "inactive-users"},
+		{"no policy for the action", workday, SubjectFromUser(owner, nil), "users:delete", doc, false, ""},
+		{"no policy for the resource", workday, SubjectFromUser(owner, nil), "documents:read", Resource{Type: "folder", ID: "1"}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := openTestEngine(t, tt.now)
+
+			decision, err := e.Authorize(context.Background(), tt.subject, tt.action, tt.resource)
+			switch {
+			case tt.allowed && err != nil:
+				t.Fatalf("Authorize = %v, want allowed\n%s", err, decision.Explain())
+			case !tt.allowed && !errors.Is(err, ErrDenied):
+				t.Fatalf("Authorize = %v, want ErrDenied\n%s", err, decision.Explain())
+			}
+
+			if decision.Allowed != tt.allowed || decision.Policy != tt.policy {
+				t.Errorf("decision = allowed %v by %q, want allowed %v by %q\n%s", decision.Allowed, decision.Policy, tt.allowed, tt.policy, decision.Explain())
+			}
+		})
+	}
+}
+
+func TestAttributesCannotOverrideTrustedOnes(t *testing.T) {
+	e := openTestEngine(t, time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC))
+
+	suspended := &data.User{ID: 9, Status: data.StatusSuspended, Role: data.RoleUser}
+	subject := SubjectFromUser(suspended, Attributes{"id": 7, "status": data.StatusActive, "role": data.RoleAdmin})
+
+	for k, want := range map[string]interface{}{"id": int64(9), "status": data.StatusSuspended, "role": data.RoleUser} {
+		if got := subject.Attributes[k]; got != want {
+			t.Errorf("subject.%s = %v, want %v", k, got, want)
+		}
+	}
+
+	ctx := WithContext(context.Background(), Attributes{"hour": 10})
+	owner := &data.User{ID: 7, Status: data.StatusActive, Role: data.RoleUser}
+	doc := Resource{Type: "document", ID: "42", Attributes: Attributes{"owner_id": 7, "type": "folder", "id": "1"}}
+
+	decision, err := e.Authorize(ctx, SubjectFromUser(owner, nil), "documents:edit", doc)
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Authorize with hour overridden = %v, want ErrDenied\n%s", err, decision.Explain())
+	}
+
+	attrs := doc.attributes()
+	if attrs["type"] != "document" || attrs["id"] != "42" {
+		t.Errorf("resource type and id = %v, %v, want document, 42", attrs["type"], attrs["id"])
+	}
+}
+
+func TestConditionUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		valid bool
+	}{
+		{"comparison", `{"eq": ["$subject.id", 7]}`, true},
+		{"nested", `{"all": [{"not": {"eq": [1, 2]}}, {"any": [{"lt": [1, 2]}]}]}`, true},
+		{"between", `{"between": ["$context.hour", 9, 18]}`, true},
+		{"no operator", `{}`, false},
+		{"two operators", `{"eq": [1, 1], "ne": [1, 2]}`, false},
+		{"unknown operator", `{"like": ["a", "b"]}`, false},
+		{"too few operands", `{"eq": [1]}`, false},
+		{"too many operands", `{"between": [1, 2, 3, 4]}`, false},
+		{"empty all", `{"all": []}`, false},
+		{"operands not a list", `{"eq": 1}`, false},
+		{"not a list of conditions", `{"any": {"eq": [1, 1]}}`, false},
+		{"bad inner condition", `{"not": {"eq": [1]}}`, false},
+		{"not an object", `["eq", 1, 1]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Condition
+			err := json.Unmarshal([]byte(tt.json), &c)
+			if tt.valid && err != nil {
+				t.Errorf("Unmarshal(%s) = %v, want nil", tt.json, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Unmarshal(%s) succeeded, want an error", tt.json)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	env := Attributes{
+		"subject": Attributes{"id": int64(7), "teams": []string{"eng", "ops"}, "level": 3},
+		"resource": Attributes{
+			"owner": Attributes{"id": json.Number("7")},
+			"tags":  []interface{}{"a", "b"},
+			"at":    "2024-03-05T10:00:00Z",
+		},
+	}
+
+	tests := []struct {
+		json string
+		want bool
+	}{
+		{`{"eq": ["$subject.id", "$resource.owner.id"]}`, true},
+		{`{"eq": ["$subject.id", 7]}`, true},
+		{`{"ne": ["$subject.id", 8]}`, true},
+		{`{"eq": ["$subject.missing", null]}`, false},
+		{`{"ne": ["$subject.missing", 1]}`, false},
+		{`{"lt": ["$subject.level", 4]}`, true},
+		{`{"gte": ["$subject.level", 4]}`, false},
+		{`{"lt": ["$subject.level", "4"]}`, false},
+		{`{"gt": ["$resource.at", "2024-01-01T00:00:00Z"]}`, true},
+		{`{"in": ["eng", "$subject.teams"]}`, true},
+		{`{"in": ["hr", "$subject.teams"]}`, false},
+		{`{"contains": ["$resource.tags", "b"]}`, true},
+		{`{"intersects": ["$subject.teams", ["hr", "ops"]]}`, true},
+		{`{"intersects": ["$subject.teams", "$resource.tags"]}`, false},
+		{`{"between": ["$subject.level", 3, 4]}`, true},
+		{`{"between": ["$subject.level", 1, 3]}`, false},
+		{`{"not": {"in": ["hr", "$subject.teams"]}}`, true},
+		{`{"any": [{"eq": [1, 2]}, {"eq": [2, 2]}]}`, true},
+		{`{"all": [{"eq": [1, 1]}, {"eq": [1, 2]}]}`, false},
+	}
+
+	for _, tt := range tests {
+		var c Condition
+		err := json.Unmarshal([]byte(tt.json), &c)
+		if err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.json, err)
+		}
+		got, why := c.evaluate(env)
+		if got != tt.want {
+			t.Errorf("%s = %v (%s), want %v", tt.json, got, why, tt.want)
+		}
+		if !got && why == "" {
+			t.Errorf("%s gave no reason for failing", tt.json)
+		}
+	}
+}
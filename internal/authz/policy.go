@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy allows or denies a set of actions on a set of resource types when
+// its condition holds. Actions and resource types may be "*", and an action
+// ending in ":*" covers every action with that prefix.
+type Policy struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Effect      string     `json:"effect"`
+	Actions     []string   `json:"actions"`
+	Resources   []string   `json:"resources"`
+	Condition   *Condition `json:"condition"`
+}
+
+func (p *Policy) validate() error {
+	switch {
+	case p.ID == "":
+		return fmt.Errorf("policy without an id")
+	case p.Effect != EffectAllow && p.Effect != EffectDeny:
+		return fmt.Errorf("policy %s: effect must be %q or %q", p.ID, EffectAllow, EffectDeny)
+	case len(p.Actions) == 0:
+		return fmt.Errorf("policy %s: no actions", p.ID)
+	}
+	return nil
+}
+
+// appliesTo reports whether the policy covers the action on the resource
+// type, before its condition is looked at.
+func (p *Policy) appliesTo(action, resourceType string) bool {
+	if !matchAny(p.Actions, action) {
+		return false
+	}
+	return len(p.Resources) == 0 || matchAny(p.Resources, resourceType)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*" || pattern == value:
+			return true
+		case strings.HasSuffix(pattern, ":*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// Condition is a boolean expression over attributes, written in JSON as an
+// object with a single operator key:
+//
+//	{"all": [cond, ...]}            every condition holds
+//	{"any": [cond, ...]}            at least one condition holds
+//	{"not": cond}                   the condition does not hold
+//	{"eq": [a, b]}, {"ne": [a, b]}
+//	{"lt": [a, b]}, {"lte": [a, b]}, {"gt": [a, b]}, {"gte": [a, b]}
+//	{"in": [value, list]}           value is an element of list
+//	{"contains": [list, value]}     list has value as an element
+//	{"intersects": [list, list]}    the lists share an element
+//	{"between": [value, low, high]} low <= value < high
+//
+// An operand that is a string starting with "$" refers to an attribute, as
+// in "$subject.id", "$resource.owner_id" or "$context.hour". Anything else is
+// a literal. A comparison involving a missing attribute is false.
+type Condition struct {
+	Op         string
+	Args       []interface{}
+	Conditions []*Condition
+}
+
+var arity = map[string]int{
+	"eq": 2, "ne": 2, "lt": 2, "lte": 2, "gt": 2, "gte": 2,
+	"in": 2, "contains": 2, "intersects": 2, "between": 3,
+}
+
+func (c *Condition) UnmarshalJSON(b []byte) error {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(b, &object)
+	if err != nil {
+		return err
+	}
+	if len(object) != 1 {
+		return fmt.Errorf("condition must have exactly one operator, got %d", len(object))
+	}
+
+	for op, raw := range object {
+		c.Op = op
+
+		switch op {
+		case "all", "any":
+			err = json.Unmarshal(raw, &c.Conditions)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if len(c.Conditions) == 0 {
+				return fmt.Errorf("%s: needs at least one condition", op)
+			}
+		case "not":
+			var inner Condition
+			err = json.Unmarshal(raw, &inner)
+			if err != nil {
+				return fmt.Errorf("not: %w", err)
+			}
+			c.Conditions = []*Condition{&inner}
+		default:
+			n, ok := arity[op]
+			if !ok {
+				return fmt.Errorf("unknown operator %q", op)
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			err = dec.Decode(&c.Args)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if len(c.Args) != n {
+				return fmt.Errorf("%s: takes %d operands, got %d", op, n, len(c.Args))
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate reports whether the condition holds in env. When it does not, the
+// returned string says which part failed, for the decision trace.
+func (c *Condition) evaluate(env Attributes) (bool, string) {
+	switch c.Op {
+	case "all":
+		for _, cond := range c.Conditions {
+			if ok, why := cond.evaluate(env); !ok {
+				return false, why
+			}
+		}
+		return true, ""
+	case "any":
+		reasons := make([]string, 0, len(c.Conditions))
+		for _, cond := range c.Conditions {
+			ok, why := cond.evaluate(env)
+			if ok {
+				return true, ""
+			}
+			reasons = append(reasons, why)
+		}
+		return false, "none of [" + strings.Join(reasons, "; ") + "]"
+	case "not":
+		if ok, _ := c.Conditions[0].evaluate(env); ok {
+			return false, "not(" + c.Conditions[0].describe(env) + ") is false"
+		}
+		return true, ""
+	}
+
+	values := make([]interface{}, len(c.Args))
+	for i, arg := range c.Args {
+		value, ok := resolve(arg, env)
+		if !ok {
+			return false, fmt.Sprintf("%s is missing", arg)
+		}
+		values[i] = value
+	}
+
+	var ok bool
+	switch c.Op {
+	case "eq":
+		ok = equal(values[0], values[1])
+	case "ne":
+		ok = !equal(values[0], values[1])
+	case "lt", "lte", "gt", "gte":
+		cmp, comparable := compare(values[0], values[1])
+		ok = comparable && (c.Op == "lt" && cmp < 0 ||
+			c.Op == "lte" && cmp <= 0 ||
+			c.Op == "gt" && cmp > 0 ||
+			c.Op == "gte" && cmp >= 0)
+	case "in":
+		ok = member(values[0], values[1])
+	case "contains":
+		ok = member(values[1], values[0])
+	case "intersects":
+		list, _ := values[0].([]interface{})
+		for _, value := range list {
+			if member(value, values[1]) {
+				ok = true
+				break
+			}
+		}
+	case "between":
+		low, lowOK := compare(values[0], values[1])
+		high, highOK := compare(values[0], values[2])
+		ok = lowOK && highOK && low >= 0 && high < 0
+	}
+
+	if !ok {
+		return false, c.describe(env) + " is false"
+	}
+	return true, ""
+}
+
+// describe renders a comparison with its attribute references resolved, such
+// as eq($subject.id=4, $resource.owner_id=7).
+func (c *Condition) describe(env Attributes) string {
+	if len(c.Args) == 0 {
+		return c.Op + "(...)"
+	}
+
+	parts := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		value, ok := resolve(arg, env)
+		switch {
+		case !isReference(arg):
+			parts[i] = fmt.Sprint(value)
+		case ok:
+			parts[i] = fmt.Sprintf("%s=%v", arg, value)
+		default:
+			parts[i] = fmt.Sprintf("%s=<missing>", arg)
+		}
+	}
+	return c.Op + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func isReference(arg interface{}) bool {
+	s, ok := arg.(string)
+	return ok && strings.HasPrefix(s, "$")
+}
+
+func resolve(arg interface{}, env Attributes) (interface{}, bool) {
+	if !isReference(arg) {
+		return normalize(arg), true
+	}
+
+	value, ok := env.lookup(strings.TrimPrefix(arg.(string), "$"))
+	if !ok {
+		return nil, false
+	}
+	return normalize(value), true
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two numbers or two strings. Strings compare bytewise,
+// which orders RFC 3339 timestamps correctly.
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+func member(value, list interface{}) bool {
+	elements, ok := list.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, element := range elements {
+		if equal(value, element) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidClaims = errors.New("invalid token claims")
+)
+
+// Audience is the aud claim, which may be a single string or an array.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the claims of an access token.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	ID        string   `json:"jti"`
+	// IssuedAtMs repeats iat in milliseconds, so a token issued just after
+	// a revocation in the same second is not taken for one issued before.
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
+
+	Scope     string `json:"scope"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	// OrgID is the organization the token acts in and OrgRole the user's
+	// role there. Role is always the user's global role, so a token for an
+	// organization the user created does not read as a global admin.
+	OrgID   int64  `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+}
+
+// ClaimsOptions configures the registered claims put into access tokens and
+// what is required of them when they come back.
+type ClaimsOptions struct {
+	Issuer string
+	// Audience lists the services tokens are minted for. A token is
+	// accepted if it names at least one of them.
+	Audience []string
+	// Leeway tolerates clock skew between the issuer and the verifier.
+	Leeway time.Duration
+	// AccessTTL is how long access tokens are valid, and so how long a
+	// revocation has to be kept to outlive the tokens it rejects.
+	AccessTTL time.Duration
+}
+
+func (c *Claims) UserID() (int64, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidClaims
+	}
+	return id, nil
+}
+
+func (c *Claims) ExpiresAtTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// IssuedAtTime returns when the token was issued, to the millisecond if the
+// token says so. Tokens without iat_ms are taken to be issued at the start
+// of their second, which errs on the side of treating them as revoked.
+func (c *Claims) IssuedAtTime() time.Time {
+	if c.IssuedAtMs != 0 {
+		return time.UnixMilli(c.IssuedAtMs)
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Valid satisfies jwt.Claims. Tokens are verified with Verify instead, which
+// knows the expected issuer and audience.
+func (c Claims) Valid() error {
+	return c.Verify(ClaimsOptions{}, time.Now())
+}
+
+// Verify checks the registered claims. Every one of them is required, unlike
+// in jwt.StandardClaims where missing claims pass.
+func (c *Claims) Verify(opts ClaimsOptions, now time.Time) error {
+	leeway := int64(opts.Leeway / time.Second)
+	unix := now.Unix()
+
+	switch {
+	case c.ID == "" || c.Subject == "":
+		return ErrInvalidClaims
+	case c.ExpiresAt == 0 || unix > c.ExpiresAt+leeway:
+		return ErrInvalidClaims
+	case c.IssuedAt == 0 || c.IssuedAt > unix+leeway:
+		return ErrInvalidClaims
+	case c.NotBefore > unix+leeway:
+		return ErrInvalidClaims
+	case c.IssuedAtMs != 0 && c.IssuedAtMs/1000 != c.IssuedAt:
+		return ErrInvalidClaims
+	case opts.Issuer != "" && c.Issuer != opts.Issuer:
+		return ErrInvalidClaims
+	}
+
+	if len(opts.Audience) > 0 {
+		for _, aud := range opts.Audience {
+			if c.Audience.Contains(aud) {
+				return nil
+			}
+		}
+		return ErrInvalidClaims
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClaimsVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	opts := ClaimsOptions{
+		Issuer:   "https://auth.example.com",
+		Audience: []string{"api"},
+		Leeway:   30 * time.Second,
+	}
+
+	valid := func() Claims {
+		return Claims{
+			Issuer:     opts.Issuer,
+			Subject:    "42",
+			Audience:   Audience{"api", "other"},
+			ExpiresAt:  now.Add(15 * time.Minute).Unix(),
+			NotBefore:  now.Unix(),
+			IssuedAt:   now.Unix(),
+			IssuedAtMs: now.UnixMilli() + 250,
+			ID:         "jti",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+		ok     bool
+	}{
+		{"valid", func(c *Claims) {}, true},
+		{"without iat_ms", func(c *Claims) { c.IssuedAtMs = 0 }, true},
+		{"expired within leeway", func(c *Claims) { c.ExpiresAt = now.Unix() - 30 }, true},
+		{"expired", func(c *Claims) { c.ExpiresAt = now.Unix() - 31 }, false},
+		{"no exp", func(c *Claims) { c.ExpiresAt = 0 }, false},
+		{"no iat", func(c *Claims) { c.IssuedAt = 0; c.IssuedAtMs = 0 }, false},
+		{"issued in the future", func(c *Claims) { c.IssuedAt = now.Unix() + 31; c.IssuedAtMs = 0 }, false},
+		{"not yet valid", func(c *Claims) { c.NotBefore = now.Unix() + 31 }, false},
+		{"iat_ms in another second", func(c *Claims) { c.IssuedAtMs = now.UnixMilli() - 1 }, false},
+		{"no jti", func(c *Claims) { c.ID = "" }, false},
+		{"no sub", func(c *Claims) { c.Subject = "" }, false},
+		{"other issuer", func(c *Claims) { c.Issuer = "https://evil.example.com" }, false},
+		{"other audience", func(c *Claims) { c.Audience = Audience{"other"} }, false},
+		{"no audience", func(c *Claims) { c.Audience = nil }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(&c)
+			err := c.Verify(opts, now)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("Verify = %v, want nil", err)
+			case !tt.ok && !errors.Is(err, ErrInvalidClaims):
+				t.Errorf("Verify = %v, want ErrInvalidClaims", err)
+			}
+		})
+	}
+}
+
+func TestClaimsIssuedAtTime(t *testing.T) {
+	c := Claims{IssuedAt: 1_700_000_000, IssuedAtMs: 1_700_000_000_250}
+	if got, want := c.IssuedAtTime(), time.UnixMilli(1_700_000_000_250); !got.Equal(want) {
+		t.Errorf("IssuedAtTime = %v, want %v", got, want)
+	}
+
+	c.IssuedAtMs = 0
+	if got, want := c.IssuedAtTime(), time.Unix(1_700_000_000, 0); !got.Equal(want) {
+		t.Errorf("IssuedAtTime without iat_ms = %v, want %v", got, want)
+	}
+}
+
+func TestAudienceJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Audience
+	}{
+		{`"api"`, Audience{"api"}},
+		{`["api","other"]`, Audience{"api", "other"}},
+		{`[]`, Audience{}},
+	}
+
+	for _, tt := range tests {
+		var got Audience
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.json, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+
+	var aud Audience
+	if err := json.Unmarshal([]byte(`42`), &aud); err == nil {
+		t.Error("Unmarshal(42) succeeded, want an error")
+	}
+
+	b, err := json.Marshal(Audience{"api"})
+	if err != nil || string(b) != `"api"` {
+		t.Errorf(`Marshal(Audience{"api"}) = %s, %v, want "api"`, b, err)
+	}
+}
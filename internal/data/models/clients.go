@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client credentials")
+)
+
+// Client is an application that obtains tokens on behalf of users or calls
+// the OAuth endpoints. Public clients, such as mobile apps, cannot keep a
+// secret and are identified by their ID alone.
+type Client struct {
+	ID         string    `json:"client_id"`
+	Secret     string    `json:"client_secret,omitempty"`
+	SecretHash []byte    `json:"-"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (c *Client) IsPublic() bool {
+	return c.SecretHash == nil
+}
+
+func ValidateClient(v *validator.Validator, client *Client) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+type ClientModel struct {
+	DB *sql.DB
+}
+
+// Insert registers a client. Unless public is set a secret is generated; its
+// plaintext is only available on the returned client.
+func (m ClientModel) Insert(client *Client, public bool) error {
+	id, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	client.ID = id
+
+	if !public {
+		client.Secret, err = randomString(32)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256([]byte(client.Secret))
+		client.SecretHash = hash[:]
+	}
+
+	query := `
+		INSERT INTO clients (id, secret_hash, name)
+		VALUES ($1, $2, $3)
+		RETURNING created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, client.ID, client.SecretHash, client.Name).Scan(&client.CreatedAt)
+}
+
+func (m ClientModel) Get(id string) (*Client, error) {
+	query := `
+		SELECT id, secret_hash, name, created_at
+		FROM clients
+		WHERE id = $1`
+	var client Client
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&client.ID,
+		&client.SecretHash,
+		&client.Name,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &client, nil
+}
+
+// Authenticate returns the client if the secret matches. Public clients only
+// authenticate without a secret.
+func (m ClientModel) Authenticate(id, secret string) (*Client, error) {
+	client, err := m.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return nil, ErrInvalidClient
+		default:
+			return nil, err
+		}
+	}
+
+	if client.IsPublic() {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], client.SecretHash) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
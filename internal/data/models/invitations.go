@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Invitation offers a role in an organization to whoever holds the
+// invitation token sent to Email. The token belongs to the member who issued
+// it, and deleting the token withdraws the invitation.
+type Invitation struct {
+	ID        int64     `json:"id"`
+	OrgID     int64     `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	TokenHash []byte    `json:"-"`
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// Insert records an invitation for a token already created with
+// TokenModel.NewToken in the invitation scope.
+func (m InvitationModel) Insert(invitation *Invitation, token *Token) error {
+	query := `
+		INSERT INTO invitations (org_id, email, role, invited_by, token_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{invitation.OrgID, invitation.Email, invitation.Role, invitation.InvitedBy, token.Hash}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "invitations" violates foreign key constraint "invitations_role_fkey"`:
+			return ErrUnknownRole
+		default:
+			return err
+		}
+	}
+
+	invitation.TokenHash = token.Hash
+	invitation.ExpiresAt = token.ExpiresAt
+	return nil
+}
+
+const invitationColumns = `
+	invitations.id, invitations.org_id, invitations.email, invitations.role, invitations.invited_by,
+	invitations.created_at, tokens.expiry, invitations.token_hash`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*Invitation, error) {
+	var invitation Invitation
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&invitation.TokenHash,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &invitation, nil
+}
+
+// Get returns a pending invitation of the organization.
+func (m InvitationModel) Get(id, orgID int64) (*Invitation, error) {
+	query := `
+		SELECT` + invitationColumns + `
+		FROM invitations
+		INNER JOIN tokens ON tokens.hash = invitations.token_hash
+		WHERE invitations.id = $1 AND invitations.org_id = $2
+		AND tokens.expiry > $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return scanInvitation(m.DB.QueryRowContext(ctx, query, id, orgID, time.Now()))
+}
+
+// GetForToken returns the pending invitation the token was issued for.
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT` + invitationColumns + `
+		FROM invitations
+		INNER JOIN tokens ON tokens.hash = invitations.token_hash
+		WHERE invitations.token_hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return scanInvitation(m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeInvitation, time.Now()))
+}
+
+// GetAllForOrg returns the organization's pending invitations, newest first.
+func (m InvitationModel) GetAllForOrg(orgID int64) ([]*Invitation, error) {
+	query := `
+		SELECT` + invitationColumns + `
+		FROM invitations
+		INNER JOIN tokens ON tokens.hash = invitations.token_hash
+		WHERE invitations.org_id = $1
+		AND tokens.expiry > $2
+		ORDER BY invitations.created_at DESC, invitations.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, orgID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// SetToken moves an invitation to a freshly issued token, for resending it.
+// The old token is deleted, so a copy of the earlier email no longer works.
+func (m InvitationModel) SetToken(invitation *Invitation, token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE invitations SET token_hash = $1 WHERE id = $2`, token.Hash, invitation.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE hash = $1`, invitation.TokenHash)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invitation.TokenHash = token.Hash
+	invitation.ExpiresAt = token.ExpiresAt
+	return nil
+}
+
+// Accept adds user to the invitation's organization, registering them first
+// if they have no ID yet. The token is used up before anything else, in the
+// same transaction, so of several concurrent accepts only one gets past it,
+// and a failure later on leaves neither an account nor a used-up token. It
+// returns ErrRecordNotFound if the token has already been used or expired.
+func (m InvitationModel) Accept(invitation *Invitation, user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3`
+	result, err := tx.ExecContext(ctx, query, invitation.TokenHash, ScopeInvitation, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	if user.ID == 0 {
+		err = insertUser(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = addMember(ctx, tx, invitation.OrgID, user.ID, invitation.Role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete withdraws an invitation by deleting its token.
+func (m InvitationModel) Delete(invitation *Invitation) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, invitation.TokenHash)
+	return err
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrMagicLinkCooldown = errors.New("magic link sent too recently")
+	ErrMagicLinkLimit    = errors.New("too many magic links sent")
+)
+
+// NewMagicLinkToken creates a magic-link token for the user. Magic links are
+// held to the same limits as one-time passcodes, so the endpoint cannot be
+// used to flood an inbox: it returns ErrMagicLinkCooldown if the last link
+// was sent less than OTPResendCooldown ago, and ErrMagicLinkLimit once
+// maxOTPsIssued links have been sent in the current OTPLimitWindow.
+func (m TokenModel) NewMagicLinkToken(user User, ttl time.Duration) (*Token, error) {
+	token, err := genereteToken(user.ID, ScopeMagicLink, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO magic_link_counters (user_id, window_start)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET window_start = EXCLUDED.window_start, issued = 0
+		WHERE magic_link_counters.window_start <= $3`
+	_, err = tx.ExecContext(ctx, query, user.ID, now, now.Add(-OTPLimitWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT issued, sent_at
+		FROM magic_link_counters
+		WHERE user_id = $1
+		FOR UPDATE`
+
+	var issued int
+	var sentAt sql.NullTime
+	err = tx.QueryRowContext(ctx, query, user.ID).Scan(&issued, &sentAt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case issued >= maxOTPsIssued:
+		return nil, ErrMagicLinkLimit
+	case sentAt.Valid && sentAt.Time.After(now.Add(-OTPResendCooldown)):
+		return nil, ErrMagicLinkCooldown
+	}
+
+	err = insertToken(ctx, tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		UPDATE magic_link_counters
+		SET issued = issued + 1, sent_at = $2
+		WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, user.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -3,6 +3,8 @@ package data
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/binsabit/authorization_practice/internal/keys"
 )
 
 var (
@@ -10,13 +12,39 @@ var (
 )
 
 type Models struct {
-	Users  UserModel
-	Tokens TokenModel
+	Users         UserModel
+	Tokens        TokenModel
+	Sessions      SessionModel
+	Revocations   RevocationModel
+	Clients       ClientModel
+	Permissions   PermissionModel
+	Roles         RoleModel
+	Relations     RelationModel
+	Organizations OrganizationModel
+	Invitations   InvitationModel
+	TOTP          TOTPModel
+	RecoveryCodes RecoveryCodeModel
+	WebAuthn      WebAuthnModel
+	OTP           OTPModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, keyring *keys.Keyring, claims ClaimsOptions, namespaces *NamespaceConfig) Models {
+	permissions := newPermissionModel(db)
+
 	return Models{
-		Users:  UserModel{DB: db},
-		Tokens: TokenModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db, Keys: keyring, Claims: claims},
+		Sessions:      SessionModel{DB: db},
+		Revocations:   newRevocationModel(db, claims.AccessTTL+claims.Leeway),
+		Clients:       ClientModel{DB: db},
+		Permissions:   permissions,
+		Roles:         RoleModel{DB: db, cache: permissions.cache},
+		Relations:     RelationModel{DB: db, Namespaces: namespaces},
+		Organizations: OrganizationModel{DB: db},
+		Invitations:   InvitationModel{DB: db},
+		TOTP:          TOTPModel{DB: db},
+		RecoveryCodes: RecoveryCodeModel{DB: db},
+		WebAuthn:      WebAuthnModel{DB: db},
+		OTP:           OTPModel{DB: db},
 	}
 }
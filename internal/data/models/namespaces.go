@@ -0,0 +1,161 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrUnknownNamespace = errors.New("unknown namespace")
+	ErrUnknownRelation  = errors.New("unknown relation")
+)
+
+// NamespaceConfig defines the object types relation tuples can be written
+// for and how their relations derive from one another.
+type NamespaceConfig struct {
+	Namespaces map[string]Namespace `json:"namespaces"`
+}
+
+// Namespace is an object type such as "document" or "group".
+type Namespace struct {
+	Relations map[string]RelationConfig `json:"relations"`
+}
+
+// RelationConfig says who has a relation to an object. Subjects of tuples
+// written for the relation always have it. On top of that:
+//
+//   - Computed names other relations on the same object whose subjects also
+//     have this one, e.g. every "owner" of a document is an "editor".
+//   - TupleToUserset follows the tuples of one relation to other objects and
+//     grants this relation to everyone with a relation there, e.g. every
+//     "viewer" of a document's "parent" folder is a "viewer" of the document.
+type RelationConfig struct {
+	Computed       []string         `json:"computed,omitempty"`
+	TupleToUserset []TupleToUserset `json:"tuple_to_userset,omitempty"`
+}
+
+type TupleToUserset struct {
+	Tupleset string `json:"tupleset"`
+	Computed string `json:"computed"`
+}
+
+// LoadNamespaces reads a namespace config from a JSON file and checks that
+// every relation it refers to is defined.
+func LoadNamespaces(path string) (*NamespaceConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg NamespaceConfig
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *NamespaceConfig) validate() error {
+	for name, ns := range c.Namespaces {
+		for relation, rc := range ns.Relations {
+			for _, computed := range rc.Computed {
+				if _, ok := ns.Relations[computed]; !ok {
+					return fmt.Errorf("%s#%s: computed relation %q is not defined", name, relation, computed)
+				}
+			}
+			for _, ttu := range rc.TupleToUserset {
+				if _, ok := ns.Relations[ttu.Tupleset]; !ok {
+					return fmt.Errorf("%s#%s: tupleset relation %q is not defined", name, relation, ttu.Tupleset)
+				}
+				if ttu.Computed == "" {
+					return fmt.Errorf("%s#%s: tuple_to_userset on %q has no computed relation", name, relation, ttu.Tupleset)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// relation returns the config of a relation, or an error if the namespace or
+// the relation is not defined.
+func (c *NamespaceConfig) relation(namespace, relation string) (RelationConfig, error) {
+	ns, ok := c.Namespaces[namespace]
+	if !ok {
+		return RelationConfig{}, fmt.Errorf("%w %q", ErrUnknownNamespace, namespace)
+	}
+	rc, ok := ns.Relations[relation]
+	if !ok {
+		return RelationConfig{}, fmt.Errorf("%w %s#%s", ErrUnknownRelation, namespace, relation)
+	}
+	return rc, nil
+}
+
+// computedFrom returns the relations of namespace that include everyone with
+// relation through Computed.
+func (c *NamespaceConfig) computedFrom(namespace, relation string) []string {
+	var relations []string
+	for name, rc := range c.Namespaces[namespace].Relations {
+		for _, computed := range rc.Computed {
+			if computed == relation {
+				relations = append(relations, name)
+			}
+		}
+	}
+	return relations
+}
+
+// reverseTupleToUserset is a TupleToUserset seen from the object it points
+// at: everyone with Computed there has Relation on the objects of Namespace
+// whose Tupleset names it.
+type reverseTupleToUserset struct {
+	Namespace string
+	Relation  string
+	Tupleset  string
+}
+
+// tupleToUsersetsFrom returns the TupleToUserset rules that grant a relation
+// to everyone with computed on the object a tupleset points at.
+func (c *NamespaceConfig) tupleToUsersetsFrom(computed string) []reverseTupleToUserset {
+	var rules []reverseTupleToUserset
+	for namespace, ns := range c.Namespaces {
+		for relation, rc := range ns.Relations {
+			for _, ttu := range rc.TupleToUserset {
+				if ttu.Computed == computed {
+					rules = append(rules, reverseTupleToUserset{Namespace: namespace, Relation: relation, Tupleset: ttu.Tupleset})
+				}
+			}
+		}
+	}
+	return rules
+}
+
+// validateTuple checks that a tuple only names namespaces and relations that
+// are defined.
+func (c *NamespaceConfig) validateTuple(t Tuple) error {
+	_, err := c.relation(t.Namespace, t.Relation)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := c.Namespaces[t.Subject.Namespace]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownNamespace, t.Subject.Namespace)
+	}
+	if t.Subject.Relation != "" {
+		_, err = c.relation(t.Subject.Namespace, t.Subject.Relation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+)
+
+var (
+	ErrDuplicateSlug       = errors.New("duplicate slug")
+	ErrDuplicateMembership = errors.New("already a member")
+)
+
+var (
+	SlugRX = "^[a-z0-9]+(?:-[a-z0-9]+)*$"
+)
+
+// Organization is a tenant. Users belong to any number of organizations,
+// with a role in each.
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Version   int       `json:"version"`
+}
+
+// Membership is a user's place in an organization.
+type Membership struct {
+	OrgID     int64         `json:"org_id"`
+	UserID    int64         `json:"user_id"`
+	Role      string        `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+	Org       *Organization `json:"organization,omitempty"`
+	User      *User         `json:"user,omitempty"`
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(org.Slug != "", "slug", "must be provided")
+	v.Check(len(org.Slug) <= 64, "slug", "must not be more than 64 bytes long")
+	v.Check(validator.Matches(org.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single dashes")
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+// Insert creates an organization with its first member, who is given role.
+func (m OrganizationModel) Insert(org *Organization, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO organizations (name, slug)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+	err = tx.QueryRowContext(ctx, query, org.Name, org.Slug).Scan(&org.ID, &org.CreatedAt, &org.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_unique_idx"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO memberships (org_id, user_id, role)
+		VALUES ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, query, org.ID, userID, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m OrganizationModel) Get(id int64) (*Organization, error) {
+	query := `
+		SELECT id, created_at, name, slug, version
+		FROM organizations
+		WHERE id = $1`
+
+	var org Organization
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.CreatedAt, &org.Name, &org.Slug, &org.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &org, nil
+}
+
+// GetMembership returns the user's membership of an organization, or
+// ErrRecordNotFound if the user is not a member.
+func (m OrganizationModel) GetMembership(orgID, userID int64) (*Membership, error) {
+	query := `
+		SELECT org_id, user_id, role, created_at
+		FROM memberships
+		WHERE org_id = $1 AND user_id = $2`
+
+	var membership Membership
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, orgID, userID).Scan(
+		&membership.OrgID,
+		&membership.UserID,
+		&membership.Role,
+		&membership.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &membership, nil
+}
+
+// GetAllForUser returns the user's memberships with their organizations,
+// oldest first.
+func (m OrganizationModel) GetAllForUser(userID int64) ([]*Membership, error) {
+	query := `
+		SELECT memberships.org_id, memberships.user_id, memberships.role, memberships.created_at,
+			organizations.created_at, organizations.name, organizations.slug, organizations.version
+		FROM memberships
+		INNER JOIN organizations ON organizations.id = memberships.org_id
+		WHERE memberships.user_id = $1
+		ORDER BY memberships.created_at, memberships.org_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*Membership{}
+	for rows.Next() {
+		membership := Membership{Org: &Organization{}}
+		err = rows.Scan(
+			&membership.OrgID,
+			&membership.UserID,
+			&membership.Role,
+			&membership.CreatedAt,
+			&membership.Org.CreatedAt,
+			&membership.Org.Name,
+			&membership.Org.Slug,
+			&membership.Org.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		membership.Org.ID = membership.OrgID
+		memberships = append(memberships, &membership)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// AddMember gives a user a role in an organization.
+func (m OrganizationModel) AddMember(orgID, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return addMember(ctx, m.DB, orgID, userID, role)
+}
+
+// addMember is AddMember on db or on a transaction.
+func addMember(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, orgID, userID int64, role string) error {
+	query := `
+		INSERT INTO memberships (org_id, user_id, role)
+		VALUES ($1, $2, $3)`
+	_, err := db.ExecContext(ctx, query, orgID, userID, role)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "memberships_pkey"`:
+			return ErrDuplicateMembership
+		case err.Error() == `pq: insert or update on table "memberships" violates foreign key constraint "memberships_role_fkey"`:
+			return ErrUnknownRole
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMember takes a user out of an organization. It returns
+// ErrRecordNotFound if the user was not a member.
+func (m OrganizationModel) RemoveMember(orgID, userID int64) error {
+	query := `
+		DELETE FROM memberships
+		WHERE org_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetMembers returns the members of an organization with their public
+// details, oldest member first.
+func (m OrganizationModel) GetMembers(orgID int64) ([]*Membership, error) {
+	query := `
+		SELECT memberships.org_id, memberships.user_id, memberships.role, memberships.created_at,
+			users.login, COALESCE(users.email, ''), users.name, users.status
+		FROM memberships
+		INNER JOIN users ON users.id = memberships.user_id
+		WHERE memberships.org_id = $1
+		ORDER BY memberships.created_at, memberships.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*Membership{}
+	for rows.Next() {
+		membership := Membership{User: &User{}}
+		err = rows.Scan(
+			&membership.OrgID,
+			&membership.UserID,
+			&membership.Role,
+			&membership.CreatedAt,
+			&membership.User.Login,
+			&membership.User.Email,
+			&membership.User.Name,
+			&membership.User.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		membership.User.ID = membership.UserID
+		memberships = append(memberships, &membership)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+const (
+	otpDigits = 6
+	OTPTTL    = 10 * time.Minute
+	// OTPResendCooldown is how long a user has to wait before another code
+	// is sent, so the endpoint cannot be used to flood their phone.
+	OTPResendCooldown = time.Minute
+	// maxOTPAttempts is how many wrong guesses a code allows before it is
+	// thrown away.
+	maxOTPAttempts = 5
+	// Within OTPLimitWindow a user is sent at most maxOTPsIssued codes, and
+	// after maxOTPFailures wrong guesses no code is accepted until the
+	// window is over. Asking for new codes does not reset either count, so
+	// guessing stays this slow however long it goes on.
+	OTPLimitWindow = 24 * time.Hour
+	maxOTPsIssued  = 10
+	maxOTPFailures = 10
+)
+
+// What a one-time passcode is for.
+const (
+	OTPPurposeLogin       = "login"
+	OTPPurposeVerifyPhone = "verify-phone"
+)
+
+var (
+	ErrOTPCooldown = errors.New("one-time passcode sent too recently")
+	ErrOTPLimit    = errors.New("too many one-time passcodes sent")
+	ErrOTPLocked   = errors.New("too many wrong one-time passcodes")
+)
+
+// OTPModel stores the one-time passcodes sent to users, to log in or to
+// prove they own a phone number. A user has at most one outstanding code per
+// purpose; like tokens, only its SHA-256 hash is kept.
+type OTPModel struct {
+	DB *sql.DB
+}
+
+// hashOTP binds a code to its user and purpose, so equal codes issued to
+// different users, or for something else, hash differently.
+func hashOTP(userID int64, purpose, code string) []byte {
+	hash := sha256.Sum256([]byte(strconv.FormatInt(userID, 10) + ":" + purpose + ":" + code))
+	return hash[:]
+}
+
+// counters returns how many codes the user has been sent and how many wrong
+// ones they have given in the current OTPLimitWindow, starting a new window
+// if the last one is over. The row stays locked until tx ends.
+func (m OTPModel) counters(ctx context.Context, tx *sql.Tx, userID int64, now time.Time) (issued, failures int, err error) {
+	query := `
+		INSERT INTO otp_counters (user_id, window_start)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET window_start = EXCLUDED.window_start, issued = 0, failures = 0
+		WHERE otp_counters.window_start <= $3`
+	_, err = tx.ExecContext(ctx, query, userID, now, now.Add(-OTPLimitWindow))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = `
+		SELECT issued, failures
+		FROM otp_counters
+		WHERE user_id = $1
+		FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&issued, &failures)
+	return issued, failures, err
+}
+
+// Issue creates a code for the user, replacing any outstanding one for the
+// same purpose, and returns it for sending over channel. It returns
+// ErrOTPCooldown if the last code was sent less than OTPResendCooldown ago,
+// and ErrOTPLimit if the user has been sent too many codes or given too many
+// wrong ones in the current OTPLimitWindow.
+func (m OTPModel) Issue(userID int64, purpose, channel string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%0*d", otpDigits, n.Int64())
+
+	now := time.Now()
+	query := `
+		INSERT INTO login_otps (user_id, purpose, channel, code_hash, attempts, sent_at, expiry)
+		VALUES ($1, $7, $2, $3, 0, $4, $5)
+		ON CONFLICT (user_id, purpose) DO UPDATE
+		SET channel = EXCLUDED.channel, code_hash = EXCLUDED.code_hash, attempts = 0,
+			sent_at = EXCLUDED.sent_at, expiry = EXCLUDED.expiry
+		WHERE login_otps.sent_at <= $6`
+	args := []interface{}{userID, channel, hashOTP(userID, purpose, code), now, now.Add(OTPTTL), now.Add(-OTPResendCooldown), purpose}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	issued, failures, err := m.counters(ctx, tx, userID, now)
+	if err != nil {
+		return "", err
+	}
+	if issued >= maxOTPsIssued || failures >= maxOTPFailures {
+		return "", ErrOTPLimit
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		return "", ErrOTPCooldown
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE otp_counters SET issued = issued + 1 WHERE user_id = $1`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Verify checks a code against the user's outstanding one for purpose. A
+// right code is used up. A wrong one counts as an attempt, and the code is
+// thrown away once maxOTPAttempts have been made, so guessing one of a
+// million codes gets a handful of tries per code sent. Wrong guesses also
+// count towards maxOTPFailures, past which Verify returns ErrOTPLocked
+// without looking at the code.
+func (m OTPModel) Verify(userID int64, purpose, code string) (bool, error) {
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, failures, err := m.counters(ctx, tx, userID, now)
+	if err != nil {
+		return false, err
+	}
+	if failures >= maxOTPFailures {
+		return false, ErrOTPLocked
+	}
+
+	query := `
+		SELECT code_hash, attempts
+		FROM login_otps
+		WHERE user_id = $1 AND purpose = $2 AND expiry > $3
+		FOR UPDATE`
+
+	var hash []byte
+	var attempts int
+	err = tx.QueryRowContext(ctx, query, userID, purpose, now).Scan(&hash, &attempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	ok := subtle.ConstantTimeCompare(hash, hashOTP(userID, purpose, code)) == 1
+	if ok || attempts+1 >= maxOTPAttempts {
+		_, err = tx.ExecContext(ctx, `DELETE FROM login_otps WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE login_otps SET attempts = attempts + 1 WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		_, err = tx.ExecContext(ctx, `UPDATE otp_counters SET failures = failures + 1 WHERE user_id = $1`, userID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// Delete throws away the user's outstanding code for purpose, if any, so it
+// can be replaced without waiting for OTPResendCooldown.
+func (m OTPModel) Delete(userID int64, purpose string) error {
+	query := `
+		DELETE FROM login_otps
+		WHERE user_id = $1 AND purpose = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, purpose)
+	return err
+}
+
+// DeleteExpired deletes up to limit codes that can no longer be used.
+func (m OTPModel) DeleteExpired(limit int) (int64, error) {
+	query := `
+		DELETE FROM login_otps
+		WHERE (user_id, purpose) IN (
+			SELECT user_id, purpose FROM login_otps
+			WHERE expiry < $1
+			LIMIT $2
+		)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
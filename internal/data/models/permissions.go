@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// permissionCacheTTL bounds how long a role change made by another instance
+// takes to be seen. Changes made through this instance are seen at once.
+const permissionCacheTTL = time.Minute
+
+// Permissions is a set of permission codes such as "users:write". A code
+// ending in ":*" grants every permission with that prefix, and "*" grants
+// everything.
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if p[i] == code || p[i] == "*" {
+			return true
+		}
+		if prefix := strings.TrimSuffix(p[i], "*"); prefix != p[i] && strings.HasSuffix(prefix, ":") && strings.HasPrefix(code, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether p grants everything other grants.
+func (p Permissions) Covers(other Permissions) bool {
+	for i := range other {
+		if !p.Include(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type cachedPermissions struct {
+	permissions Permissions
+	expiry      time.Time
+}
+
+type permissionCache struct {
+	mu    sync.RWMutex
+	roles map[string]cachedPermissions
+}
+
+func (c *permissionCache) get(role string) (Permissions, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.roles[role]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, false
+	}
+	return entry.permissions, true
+}
+
+func (c *permissionCache) set(role string, permissions Permissions) {
+	c.mu.Lock()
+	c.roles[role] = cachedPermissions{permissions: permissions, expiry: time.Now().Add(permissionCacheTTL)}
+	c.mu.Unlock()
+}
+
+// clear drops every entry. A change to one role affects every role that
+// inherits from it, so entries are not invalidated one by one.
+func (c *permissionCache) clear() {
+	c.mu.Lock()
+	c.roles = make(map[string]cachedPermissions)
+	c.mu.Unlock()
+}
+
+// PermissionModel resolves what a role grants, including everything granted
+// to the roles it inherits from. Resolved sets are cached per role so
+// RequirePermission usually costs no query.
+type PermissionModel struct {
+	DB    *sql.DB
+	cache *permissionCache
+}
+
+func newPermissionModel(db *sql.DB) PermissionModel {
+	return PermissionModel{
+		DB:    db,
+		cache: &permissionCache{roles: make(map[string]cachedPermissions)},
+	}
+}
+
+// GetAllForRole returns the permissions granted to a role and its ancestors.
+func (m PermissionModel) GetAllForRole(role string) (Permissions, error) {
+	if permissions, ok := m.cache.get(role); ok {
+		return permissions, nil
+	}
+
+	// UNION rather than UNION ALL stops the recursion at a role already
+	// visited, should a cycle ever get past RoleModel.Save.
+	query := `
+		WITH RECURSIVE ancestors (name) AS (
+			SELECT $1::text
+			UNION
+			SELECT role_parents.parent
+			FROM role_parents
+			INNER JOIN ancestors ON role_parents.role = ancestors.name
+		)
+		SELECT DISTINCT permission
+		FROM roles_permissions
+		WHERE role IN (SELECT name FROM ancestors)
+		ORDER BY permission`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache.set(role, permissions)
+	return permissions, nil
+}
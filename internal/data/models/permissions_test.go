@@ -0,0 +1,51 @@
+package data
+
+import "testing"
+
+func TestPermissionsInclude(t *testing.T) {
+	p := Permissions{"users:read", "roles:*"}
+
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"users:read", true},
+		{"users:write", false},
+		{"roles:write", true},
+		{"roles:*", true},
+		{"rolesx:write", false},
+		{"*", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.Include(tt.code); got != tt.want {
+			t.Errorf("Include(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+
+	if !(Permissions{"*"}).Include("anything:at-all") {
+		t.Error(`Permissions{"*"} does not include everything`)
+	}
+}
+
+func TestPermissionsCovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Permissions
+		other Permissions
+		want  bool
+	}{
+		{"same", Permissions{"members:read", "members:write"}, Permissions{"members:write"}, true},
+		{"nothing", Permissions{"members:read"}, nil, true},
+		{"wildcard covers code", Permissions{"members:*"}, Permissions{"members:write"}, true},
+		{"code does not cover wildcard", Permissions{"members:read", "members:write"}, Permissions{"members:*"}, false},
+		{"missing code", Permissions{"members:write"}, Permissions{"members:write", "org:write"}, false},
+		{"everything", Permissions{"*"}, Permissions{"org:*", "members:write"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.Covers(tt.other); got != tt.want {
+			t.Errorf("%s: %v.Covers(%v) = %v, want %v", tt.name, tt.p, tt.other, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// recoveryCodeCount is how many codes a user gets at a time.
+const recoveryCodeCount = 10
+
+// RecoveryCodeModel stores single-use codes that stand in for an
+// authenticator app that was lost. Like tokens, only their SHA-256 hashes are
+// kept.
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// normalizeRecoveryCode lets a code be typed in either case, with or without
+// its dashes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hash[:]
+}
+
+// Generate replaces the user's recovery codes with a new set and returns
+// them. This is the only time the codes can be seen.
+func (m RecoveryCodeModel) Generate(userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		// 10 random bytes make 16 base32 characters, shown as
+		// XXXX-XXXX-XXXX-XXXX.
+		s, err := randomString(10)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = s[:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hashRecoveryCode(code), userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Use consumes a recovery code, reporting whether it was one of the user's
+// unused codes.
+func (m RecoveryCodeModel) Use(userID int64, code string) (bool, error) {
+	query := `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1 AND hash = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// Count returns how many unused codes the user has left.
+func (m RecoveryCodeModel) Count(userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM recovery_codes
+		WHERE user_id = $1`
+	var count int
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (m RecoveryCodeModel) DeleteAllForUser(userID int64) error {
+	query := `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,480 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRelationDepth bounds how many relations a check may follow, so a deep
+// or badly configured graph costs a bounded number of queries.
+const maxRelationDepth = 16
+
+var (
+	ErrInvalidTuple    = errors.New("invalid relation tuple")
+	ErrRelationTooDeep = errors.New("relation graph too deep")
+)
+
+// Subject is who a tuple grants a relation to: either a single object such
+// as user:7, or everyone with a relation to an object (a userset) such as
+// group:eng#member.
+type Subject struct {
+	Namespace string
+	ID        string
+	Relation  string
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Namespace + ":" + s.ID
+	}
+	return s.Namespace + ":" + s.ID + "#" + s.Relation
+}
+
+// ParseSubject parses "namespace:id" or "namespace:id#relation".
+func ParseSubject(s string) (Subject, error) {
+	var subject Subject
+
+	object, relation, hasRelation := strings.Cut(s, "#")
+	if hasRelation {
+		if relation == "" {
+			return Subject{}, ErrInvalidTuple
+		}
+		subject.Relation = relation
+	}
+
+	namespace, id, ok := strings.Cut(object, ":")
+	if !ok || namespace == "" || id == "" || strings.Contains(id, "@") {
+		return Subject{}, ErrInvalidTuple
+	}
+	subject.Namespace = namespace
+	subject.ID = id
+	return subject, nil
+}
+
+// Tuple states that a subject has a relation to an object, written
+// namespace:id#relation@subject as in document:42#editor@user:7.
+type Tuple struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+	Subject   Subject
+}
+
+func (t Tuple) String() string {
+	return t.Namespace + ":" + t.ObjectID + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+func ParseTuple(s string) (Tuple, error) {
+	object, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, ErrInvalidTuple
+	}
+
+	o, err := ParseSubject(object)
+	if err != nil || o.Relation == "" {
+		return Tuple{}, ErrInvalidTuple
+	}
+
+	sub, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	return Tuple{Namespace: o.Namespace, ObjectID: o.ID, Relation: o.Relation, Subject: sub}, nil
+}
+
+// ExpandNode is one relation in the tree returned by Expand. Subjects lists
+// who has the relation through tuples of their own; Children are the
+// usersets and derived relations whose subjects have it too.
+type ExpandNode struct {
+	Object   string        `json:"object"`
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+// RelationModel stores relation tuples and answers questions about them
+// using the rules in the namespace config. Tuples belong to an organization
+// and every method works within one, so one tenant's tuples never grant
+// anything in another.
+type RelationModel struct {
+	DB         *sql.DB
+	Namespaces *NamespaceConfig
+}
+
+// Write stores tuples, ignoring those that already exist. Either all of them
+// are written or none is.
+func (m RelationModel) Write(orgID int64, tuples []Tuple) error {
+	for _, t := range tuples {
+		err := m.Namespaces.validateTuple(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO relation_tuples (org_id, namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING`
+
+	return m.inTx(func(ctx context.Context, tx *sql.Tx) error {
+		for _, t := range tuples {
+			_, err := tx.ExecContext(ctx, query, orgID, t.Namespace, t.ObjectID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes tuples. Tuples that do not exist are ignored.
+func (m RelationModel) Delete(orgID int64, tuples []Tuple) error {
+	query := `
+		DELETE FROM relation_tuples
+		WHERE org_id = $1 AND namespace = $2 AND object_id = $3 AND relation = $4
+		AND subject_namespace = $5 AND subject_id = $6 AND subject_relation = $7`
+
+	return m.inTx(func(ctx context.Context, tx *sql.Tx) error {
+		for _, t := range tuples {
+			_, err := tx.ExecContext(ctx, query, orgID, t.Namespace, t.ObjectID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m RelationModel) inTx(fn func(context.Context, *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Check reports whether subject has relation to the object, directly, through
+// a userset, or through a computed relation.
+func (m RelationModel) Check(orgID int64, namespace, objectID, relation string, subject Subject) (bool, error) {
+	_, err := m.Namespaces.relation(namespace, relation)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.check(ctx, orgID, namespace, objectID, relation, subject, 0, make(map[string]bool))
+}
+
+// check walks the relation graph depth first. visited cuts cycles between
+// usersets, such as two groups that are members of each other.
+func (m RelationModel) check(ctx context.Context, orgID int64, namespace, objectID, relation string, subject Subject, depth int, visited map[string]bool) (bool, error) {
+	if depth > maxRelationDepth {
+		return false, ErrRelationTooDeep
+	}
+
+	key := namespace + ":" + objectID + "#" + relation
+	if visited[key] {
+		return false, nil
+	}
+	visited[key] = true
+
+	rc, err := m.Namespaces.relation(namespace, relation)
+	if err != nil {
+		return false, err
+	}
+
+	subjects, err := m.subjects(ctx, orgID, namespace, objectID, relation)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range subjects {
+		if s == subject {
+			return true, nil
+		}
+	}
+
+	for _, s := range subjects {
+		if s.Relation == "" {
+			continue
+		}
+		ok, err := m.check(ctx, orgID, s.Namespace, s.ID, s.Relation, subject, depth+1, visited)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+
+	for _, computed := range rc.Computed {
+		ok, err := m.check(ctx, orgID, namespace, objectID, computed, subject, depth+1, visited)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+
+	for _, ttu := range rc.TupleToUserset {
+		parents, err := m.subjects(ctx, orgID, namespace, objectID, ttu.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, parent := range parents {
+			// The computed relation may not exist on every namespace the
+			// tupleset points at; such objects grant nothing.
+			if _, err := m.Namespaces.relation(parent.Namespace, ttu.Computed); err != nil {
+				continue
+			}
+			ok, err := m.check(ctx, orgID, parent.Namespace, parent.ID, ttu.Computed, subject, depth+1, visited)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Expand returns the tree of everyone who has relation to the object.
+func (m RelationModel) Expand(orgID int64, namespace, objectID, relation string) (*ExpandNode, error) {
+	_, err := m.Namespaces.relation(namespace, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.expand(ctx, orgID, namespace, objectID, relation, 0, make(map[string]bool))
+}
+
+func (m RelationModel) expand(ctx context.Context, orgID int64, namespace, objectID, relation string, depth int, visited map[string]bool) (*ExpandNode, error) {
+	if depth > maxRelationDepth {
+		return nil, ErrRelationTooDeep
+	}
+
+	node := &ExpandNode{Object: namespace + ":" + objectID + "#" + relation}
+	if visited[node.Object] {
+		return node, nil
+	}
+	visited[node.Object] = true
+
+	rc, err := m.Namespaces.relation(namespace, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, err := m.subjects(ctx, orgID, namespace, objectID, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	addChild := func(namespace, objectID, relation string) error {
+		child, err := m.expand(ctx, orgID, namespace, objectID, relation, depth+1, visited)
+		if err != nil {
+			return err
+		}
+		node.Children = append(node.Children, child)
+		return nil
+	}
+
+	for _, s := range subjects {
+		if s.Relation == "" {
+			node.Subjects = append(node.Subjects, s.String())
+			continue
+		}
+		err = addChild(s.Namespace, s.ID, s.Relation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, computed := range rc.Computed {
+		err = addChild(namespace, objectID, computed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ttu := range rc.TupleToUserset {
+		parents, err := m.subjects(ctx, orgID, namespace, objectID, ttu.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			if _, err := m.Namespaces.relation(parent.Namespace, ttu.Computed); err != nil {
+				continue
+			}
+			err = addChild(parent.Namespace, parent.ID, ttu.Computed)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return node, nil
+}
+
+// ListObjects returns the IDs of the objects in namespace that subject has
+// relation to. Rather than checking every object in the namespace, it walks
+// the relation graph backwards from the subject, the way check walks it
+// forwards, so the work grows with what the subject can reach.
+func (m RelationModel) ListObjects(orgID int64, namespace, relation string, subject Subject) ([]string, error) {
+	_, err := m.Namespaces.relation(namespace, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reached := make(map[relationNode]bool)
+	var frontier []relationNode
+	reach := func(n relationNode) {
+		if !reached[n] {
+			reached[n] = true
+			frontier = append(frontier, n)
+		}
+	}
+
+	direct, err := m.objectsWith(ctx, orgID, subject, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range direct {
+		reach(n)
+	}
+
+	for depth := 0; len(frontier) > 0; depth++ {
+		if depth > maxRelationDepth {
+			return nil, ErrRelationTooDeep
+		}
+
+		current := frontier
+		frontier = nil
+		for _, n := range current {
+			// Tuples granting a relation to everyone with n, as a userset.
+			usersets, err := m.objectsWith(ctx, orgID, Subject{Namespace: n.Namespace, ID: n.ObjectID, Relation: n.Relation}, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, u := range usersets {
+				reach(u)
+			}
+
+			for _, computed := range m.Namespaces.computedFrom(n.Namespace, n.Relation) {
+				reach(relationNode{Namespace: n.Namespace, ObjectID: n.ObjectID, Relation: computed})
+			}
+
+			rules := m.Namespaces.tupleToUsersetsFrom(n.Relation)
+			if len(rules) == 0 {
+				continue
+			}
+			children, err := m.objectsWith(ctx, orgID, Subject{Namespace: n.Namespace, ID: n.ObjectID}, true)
+			if err != nil {
+				return nil, err
+			}
+			for _, rule := range rules {
+				for _, child := range children {
+					if child.Namespace == rule.Namespace && child.Relation == rule.Tupleset {
+						reach(relationNode{Namespace: child.Namespace, ObjectID: child.ObjectID, Relation: rule.Relation})
+					}
+				}
+			}
+		}
+	}
+
+	objects := []string{}
+	for n := range reached {
+		if n.Namespace == namespace && n.Relation == relation {
+			objects = append(objects, n.ObjectID)
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// relationNode is one relation of one object, such as document:42#editor.
+type relationNode struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+}
+
+// objectsWith returns the relations granted by tuples whose subject is s,
+// read through relation_tuples_subject_idx. With anyRelation, tuples whose
+// subject is a userset on s's object match too, as check ignores the
+// subject relation when following a tupleset.
+func (m RelationModel) objectsWith(ctx context.Context, orgID int64, s Subject, anyRelation bool) ([]relationNode, error) {
+	query := `
+		SELECT namespace, object_id, relation
+		FROM relation_tuples
+		WHERE org_id = $1 AND subject_namespace = $2 AND subject_id = $3
+		AND ($4 OR subject_relation = $5)`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID, s.Namespace, s.ID, anyRelation, s.Relation)
+	if err != nil {
+		return nil, fmt.Errorf("reading tuples for %s: %w", s, err)
+	}
+	defer rows.Close()
+
+	var nodes []relationNode
+	for rows.Next() {
+		var n relationNode
+		err = rows.Scan(&n.Namespace, &n.ObjectID, &n.Relation)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// subjects returns the subjects of the tuples written for one relation of
+// one object.
+func (m RelationModel) subjects(ctx context.Context, orgID int64, namespace, objectID, relation string) ([]Subject, error) {
+	query := `
+		SELECT subject_namespace, subject_id, subject_relation
+		FROM relation_tuples
+		WHERE org_id = $1 AND namespace = $2 AND object_id = $3 AND relation = $4`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID, namespace, objectID, relation)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s:%s#%s: %w", namespace, objectID, relation, err)
+	}
+	defer rows.Close()
+
+	var subjects []Subject
+	for rows.Next() {
+		var s Subject
+		err = rows.Scan(&s.Namespace, &s.ID, &s.Relation)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return subjects, nil
+}
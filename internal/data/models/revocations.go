@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RevokeToken   = "jti"
+	RevokeSession = "sid"
+	RevokeUser    = "user"
+)
+
+// Revocation rejects access tokens before they expire. A token revocation
+// matches a single jti; session and user revocations match every token of the
+// session or user that was issued up to RevokedAt.
+type Revocation struct {
+	Kind      string
+	Value     string
+	RevokedAt time.Time
+	Expiry    time.Time
+}
+
+type revocationKey struct {
+	kind  string
+	value string
+}
+
+type revocationCache struct {
+	mu      sync.RWMutex
+	entries map[revocationKey]Revocation
+}
+
+// RevocationModel stores revocations in Postgres and answers lookups from an
+// in-memory copy, so checking a token on every request costs no query. The
+// copy is refreshed by Sync to pick up revocations made by other instances.
+type RevocationModel struct {
+	DB *sql.DB
+	// TTL is how long session and user revocations are kept: long enough
+	// for every access token they reject to have expired.
+	TTL   time.Duration
+	cache *revocationCache
+}
+
+func newRevocationModel(db *sql.DB, ttl time.Duration) RevocationModel {
+	return RevocationModel{
+		DB:    db,
+		TTL:   ttl,
+		cache: &revocationCache{entries: make(map[revocationKey]Revocation)},
+	}
+}
+
+// Revoke records a revocation that lasts for ttl. Revoking the same value
+// again moves RevokedAt forward so newer tokens are rejected too. RevokedAt
+// is taken from this server's clock, the one iat is set from.
+func (m RevocationModel) Revoke(kind, value string, ttl time.Duration) error {
+	query := `
+		INSERT INTO revocations (kind, value, revoked_at, expiry)
+		VALUES ($1, $2, $4, $3)
+		ON CONFLICT (kind, value) DO UPDATE
+		SET revoked_at = EXCLUDED.revoked_at, expiry = GREATEST(revocations.expiry, EXCLUDED.expiry)
+		RETURNING revoked_at, expiry`
+
+	revocation := Revocation{Kind: kind, Value: value}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	now := time.Now()
+	err := m.DB.QueryRowContext(ctx, query, kind, value, now.Add(ttl), now).Scan(&revocation.RevokedAt, &revocation.Expiry)
+	if err != nil {
+		return err
+	}
+
+	m.cache.mu.Lock()
+	m.cache.entries[revocationKey{kind, value}] = revocation
+	m.cache.mu.Unlock()
+
+	return nil
+}
+
+// RevokeSession rejects every access token issued so far for a session.
+func (m RevocationModel) RevokeSession(sessionID string) error {
+	return m.Revoke(RevokeSession, sessionID, m.TTL)
+}
+
+// RevokeUser rejects every access token issued so far for a user, for
+// instance after a password change or a ban.
+func (m RevocationModel) RevokeUser(userID int64) error {
+	return m.Revoke(RevokeUser, strconv.FormatInt(userID, 10), m.TTL)
+}
+
+// IsRevoked reports whether an access token has been revoked directly, through
+// its session or through its user.
+func (m RevocationModel) IsRevoked(jti, sessionID string, userID int64, issuedAt time.Time) bool {
+	now := time.Now()
+
+	m.cache.mu.RLock()
+	defer m.cache.mu.RUnlock()
+
+	if jti != "" {
+		if r, ok := m.cache.entries[revocationKey{RevokeToken, jti}]; ok && r.Expiry.After(now) {
+			return true
+		}
+	}
+
+	if sessionID != "" {
+		if r, ok := m.cache.entries[revocationKey{RevokeSession, sessionID}]; ok && r.Expiry.After(now) && revokedBefore(issuedAt, r.RevokedAt) {
+			return true
+		}
+	}
+
+	if r, ok := m.cache.entries[revocationKey{RevokeUser, strconv.FormatInt(userID, 10)}]; ok && r.Expiry.After(now) && revokedBefore(issuedAt, r.RevokedAt) {
+		return true
+	}
+
+	return false
+}
+
+// revokedBefore reports whether a token was issued strictly before the
+// revocation, so a token issued right after it, such as on the login that
+// follows a password reset, stays valid.
+func revokedBefore(issuedAt, revokedAt time.Time) bool {
+	return issuedAt.Before(revokedAt)
+}
+
+// Sync replaces the in-memory copy with the unexpired revocations in Postgres.
+func (m RevocationModel) Sync() error {
+	query := `
+		SELECT kind, value, revoked_at, expiry
+		FROM revocations
+		WHERE expiry > NOW()`
+
+	started := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	entries := make(map[revocationKey]Revocation)
+	for rows.Next() {
+		var r Revocation
+		err = rows.Scan(&r.Kind, &r.Value, &r.RevokedAt, &r.Expiry)
+		if err != nil {
+			return err
+		}
+		entries[revocationKey{r.Kind, r.Value}] = r
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	m.cache.mu.Lock()
+	defer m.cache.mu.Unlock()
+
+	// Keep revocations made here while the query was running.
+	for key, r := range m.cache.entries {
+		if _, ok := entries[key]; !ok && r.Expiry.After(started) && !r.RevokedAt.Before(started.Add(-time.Second)) {
+			entries[key] = r
+		}
+	}
+	m.cache.entries = entries
+
+	return nil
+}
+
+// DeleteExpired deletes up to limit revocations whose tokens have all expired.
+func (m RevocationModel) DeleteExpired(limit int) (int64, error) {
+	query := `
+		DELETE FROM revocations
+		WHERE (kind, value) IN (
+			SELECT kind, value FROM revocations
+			WHERE expiry < NOW()
+			LIMIT $1
+		)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,27 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevokedBefore(t *testing.T) {
+	revokedAt := time.UnixMilli(1_700_000_000_500)
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"earlier second", time.Unix(1_699_999_999, 0), true},
+		{"earlier in the same second", time.UnixMilli(1_700_000_000_499), true},
+		{"at the same instant", revokedAt, false},
+		{"later in the same second", time.UnixMilli(1_700_000_000_501), false},
+	}
+
+	for _, tt := range tests {
+		if got := revokedBefore(tt.issuedAt, revokedAt); got != tt.want {
+			t.Errorf("%s: revokedBefore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRoleCycle         = errors.New("role would inherit from itself")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// Role is a named set of permissions. A role also has every permission of
+// its parents, and of theirs in turn.
+type Role struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parents     []string    `json:"parents"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 64, "name", "must not be more than 64 bytes long")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(validator.Unique(role.Parents), "parents", "must not contain duplicate values")
+	v.Check(!validator.In(role.Name, role.Parents...), "parents", "must not contain the role itself")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+}
+
+// RoleModel stores the role graph. It shares the permission cache with
+// PermissionModel so it can drop resolved sets when the graph changes.
+type RoleModel struct {
+	DB    *sql.DB
+	cache *permissionCache
+}
+
+// Get returns a role with its direct parents and the permissions granted to
+// it directly, not the ones it inherits.
+func (m RoleModel) Get(name string) (*Role, error) {
+	query := `
+		SELECT name, description,
+			ARRAY(SELECT parent FROM role_parents WHERE role = roles.name ORDER BY parent),
+			ARRAY(SELECT permission FROM roles_permissions WHERE role = roles.name ORDER BY permission)
+		FROM roles
+		WHERE name = $1`
+
+	var role Role
+	var permissions []string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&role.Name, &role.Description, pq.Array(&role.Parents), pq.Array(&permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	role.Permissions = permissions
+	return &role, nil
+}
+
+// Save creates or replaces a role, its parents and its direct permissions.
+// It returns ErrRoleCycle if the role would end up among its own ancestors.
+// Writers are serialized so two concurrent saves cannot form a cycle that
+// neither would have formed alone.
+func (m RoleModel) Save(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `LOCK TABLE role_parents IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO roles (name, description)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description`
+	_, err = tx.ExecContext(ctx, query, role.Name, role.Description)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM role_parents WHERE role = $1`, role.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, parent := range role.Parents {
+		_, err = tx.ExecContext(ctx, `INSERT INTO role_parents (role, parent) VALUES ($1, $2)`, role.Name, parent)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: insert or update on table "role_parents" violates foreign key constraint "role_parents_parent_fkey"`:
+				return ErrUnknownRole
+			case err.Error() == `pq: new row for relation "role_parents" violates check constraint "role_parents_not_self"`:
+				return ErrRoleCycle
+			default:
+				return err
+			}
+		}
+	}
+
+	query = `
+		WITH RECURSIVE ancestors (name) AS (
+			SELECT parent FROM role_parents WHERE role = $1
+			UNION
+			SELECT role_parents.parent
+			FROM role_parents
+			INNER JOIN ancestors ON role_parents.role = ancestors.name
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE name = $1)`
+
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, role.Name).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrRoleCycle
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role = $1`, role.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, permission := range role.Permissions {
+		_, err = tx.ExecContext(ctx, `INSERT INTO roles_permissions (role, permission) VALUES ($1, $2)`, role.Name, permission)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: insert or update on table "roles_permissions" violates foreign key constraint "roles_permissions_permission_fkey"`:
+				return ErrUnknownPermission
+			default:
+				return err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.cache.clear()
+	return nil
+}
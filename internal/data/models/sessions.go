@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Session is a login on one device. Its ID doubles as the family ID of the
+// refresh tokens issued to that device, so deleting a session revokes them.
+type Session struct {
+	ID       string `json:"id"`
+	UserID   int64  `json:"-"`
+	ClientID string `json:"client_id,omitempty"`
+	OrgID    int64  `json:"org_id,omitempty"`
+	// OrgRole is the user's role in OrgID, empty when the user is no longer
+	// a member.
+	OrgRole    string    `json:"-"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+func (m SessionModel) Insert(session *Session) error {
+	id, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	session.ID = id
+
+	query := `
+		INSERT INTO sessions (id, user_id, client_id, org_id, device_name, user_agent, ip)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, 0), $5, $6, $7)
+		RETURNING created_at, last_used_at`
+	args := []interface{}{session.ID, session.UserID, session.ClientID, session.OrgID, session.DeviceName, session.UserAgent, session.IP}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&session.CreatedAt, &session.LastUsedAt)
+}
+
+// Get returns a session along with the user's role in the session's
+// organization, if it has one.
+func (m SessionModel) Get(id string) (*Session, error) {
+	query := `
+		SELECT sessions.id, sessions.user_id, COALESCE(sessions.client_id, ''), COALESCE(sessions.org_id, 0),
+			COALESCE(memberships.role, ''), sessions.device_name, sessions.user_agent, sessions.ip,
+			sessions.created_at, sessions.last_used_at
+		FROM sessions
+		LEFT JOIN memberships ON memberships.org_id = sessions.org_id AND memberships.user_id = sessions.user_id
+		WHERE sessions.id = $1`
+	var session Session
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.ClientID,
+		&session.OrgID,
+		&session.OrgRole,
+		&session.DeviceName,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+// GetAllForUser returns the sessions that still hold a usable refresh token,
+// most recently used first.
+func (m SessionModel) GetAllForUser(userID int64) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, COALESCE(client_id, ''), COALESCE(org_id, 0), device_name, user_agent, ip, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1
+		AND EXISTS (
+			SELECT 1 FROM tokens
+			WHERE tokens.family_id = sessions.id
+			AND tokens.expiry > $2
+			AND tokens.is_exposed = false
+		)
+		ORDER BY last_used_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.ClientID,
+			&session.OrgID,
+			&session.DeviceName,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch records that the session was just used to refresh its tokens.
+func (m SessionModel) Touch(id, ip string) error {
+	query := `
+		UPDATE sessions
+		SET last_used_at = NOW(), ip = $2
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, ip)
+	return err
+}
+
+// SetOrg switches the organization the session's tokens are issued for. An
+// orgID of 0 leaves the session outside any organization.
+func (m SessionModel) SetOrg(id string, orgID int64) error {
+	query := `
+		UPDATE sessions
+		SET org_id = NULLIF($2, 0)
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, orgID)
+	return err
+}
+
+// Delete ends a session along with its refresh tokens.
+func (m SessionModel) Delete(id string) error {
+	query := `
+		DELETE FROM sessions
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// DeleteForUser ends a session only if it belongs to the user.
+func (m SessionModel) DeleteForUser(id string, userID int64) error {
+	query := `
+		DELETE FROM sessions
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser ends every session of the user except the one given, which
+// may be empty to end them all.
+func (m SessionModel) DeleteAllForUser(userID int64, exceptID string) error {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND id <> $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, exceptID)
+	return err
+}
+
+// DeleteAllForOrg ends every session the user has acting in an organization
+// and returns their IDs.
+func (m SessionModel) DeleteAllForOrg(userID, orgID int64) ([]string, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND org_id = $2
+		RETURNING id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteStale deletes up to limit sessions that have no refresh tokens left,
+// which happens once their last token expires. Sessions younger than a minute
+// are skipped as their first token may not be inserted yet.
+func (m SessionModel) DeleteStale(limit int) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE id IN (
+			SELECT id FROM sessions
+			WHERE created_at < NOW() - INTERVAL '1 minute'
+			AND NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.family_id = sessions.id)
+			LIMIT $1
+		)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDeleted   = "deleted"
+
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// statusTransitions lists the statuses a user may move to from each status.
+// Deleted is final.
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusActive, StatusDeleted},
+	StatusActive:    {StatusSuspended, StatusDeleted},
+	StatusSuspended: {StatusActive, StatusDeleted},
+	StatusDeleted:   {},
+}
+
+// TransitionTo moves the user to status if the lifecycle allows it. The
+// change still has to be saved with UserModel.Update.
+func (u *User) TransitionTo(status string) error {
+	for _, allowed := range statusTransitions[u.Status] {
+		if allowed == status {
+			u.Status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("%w from %q to %q", ErrInvalidTransition, u.Status, status)
+}
+
+// IsActive reports whether the user may authenticate.
+func (u *User) IsActive() bool {
+	return u.Status == StatusActive
+}
@@ -6,29 +6,41 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/binsabit/authorization_practice/internal/data/validator"
+	"github.com/binsabit/authorization_practice/internal/keys"
 	"github.com/golang-jwt/jwt"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeInvitation     = "invitation"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeMagicLink      = "magic-link"
 	TypeAccess          = "access"
 	TypeRefresh         = "refresh"
-	Secretkey           = "mysecret"
 	accessTokenExp      = time.Minute * 15
 	refreshTokenExp     = time.Hour * 25 * 7
 )
 
+var (
+	ErrTokenReused = errors.New("refresh token reused")
+)
+
 type Token struct {
 	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"."`
+	Hash      []byte    `json:"-"`
 	Scope     string    `json:"scope"`
 	ExpiresAt time.Time `json:"expires_at"`
-	UserID    int64     `json:"."`
-	IsExposed bool      `json:"."`
+	UserID    int64     `json:"-"`
+	IsExposed bool      `json:"-"`
+	FamilyID  string    `json:"-"`
 }
 
 type AuthToken struct {
@@ -43,13 +55,12 @@ func genereteToken(userID int64, scope string, ttl time.Duration) (*Token, error
 		Scope:     scope,
 	}
 
-	randomBytes := make([]byte, 32)
-	_, err := rand.Read(randomBytes)
+	plaintext, err := randomString(32)
 	if err != nil {
 		return nil, err
 	}
 
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Plaintext = plaintext
 
 	hash := sha256.Sum256([]byte(token.Plaintext))
 	token.Hash = hash[:]
@@ -57,26 +68,52 @@ func genereteToken(userID int64, scope string, ttl time.Duration) (*Token, error
 	return token, nil
 }
 
+func randomString(n int) (string, error) {
+	randomBytes := make([]byte, n)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Keys   *keys.Keyring
+	Claims ClaimsOptions
 }
 
-func (m TokenModel) generateJWTToken(userID int64, ttd time.Duration, scope, role string) (string, error) {
+func (m TokenModel) generateJWTToken(userID int64, session *Session, ttd time.Duration, scope, role string) (string, error) {
 
-	signKey := []byte(Secretkey)
-	t := jwt.New(jwt.SigningMethodHS256)
-	claims := t.Claims.(jwt.MapClaims)
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
 
-	claims["scope"] = scope
-	claims["user_id"] = userID
-	claims["role"] = role
-	claims["exp"] = time.Now().Add(ttd).Unix()
+	now := time.Now()
+	claims := Claims{
+		Issuer:     m.Claims.Issuer,
+		Subject:    strconv.FormatInt(userID, 10),
+		Audience:   m.Claims.Audience,
+		ExpiresAt:  now.Add(ttd).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		ID:         jti,
+		IssuedAtMs: now.UnixMilli(),
+		Scope:      scope,
+		Role:       role,
+		SessionID:  session.ID,
+		ClientID:   session.ClientID,
+		OrgID:      session.OrgID,
+		OrgRole:    session.OrgRole,
+	}
 
-	tokenString, err := t.SignedString(signKey)
+	tokenString, err := m.Keys.Active().Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -85,14 +122,65 @@ func (m TokenModel) generateJWTToken(userID int64, ttd time.Duration, scope, rol
 
 }
 
-func (m TokenModel) NewAuthToken(user User, ttlAccess, ttlRefresh time.Duration) (interface{}, error) {
-	accessToken, err := m.generateJWTToken(user.ID, ttlAccess, TypeAccess, user.Role)
+// ParseAccessToken verifies an access token's signature and claims. The
+// signing algorithm must be one we sign with and match the key named by kid,
+// so a token cannot pick its own algorithm.
+func (m TokenModel) ParseAccessToken(rawToken string) (*Claims, error) {
+	parser := jwt.Parser{
+		ValidMethods:         []string{keys.AlgRS256, keys.AlgES256, keys.AlgEdDSA},
+		SkipClaimsValidation: true,
+	}
+
+	var claims Claims
+	_, err := parser.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := m.Keys.Lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+		return key.PublicKey(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = claims.Verify(m.Claims, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Scope != TypeAccess {
+		return nil, ErrInvalidClaims
+	}
+
+	return &claims, nil
+}
+
+// NewAccessToken issues an access token for a session. The token carries the
+// user's global role, and in an organization their role there as org_role.
+func (m TokenModel) NewAccessToken(user User, session *Session, ttl time.Duration) (string, error) {
+	return m.generateJWTToken(user.ID, session, ttl, TypeAccess, user.Role)
+}
+
+// NewAuthToken issues an access token and a refresh token for a session. The
+// refresh token starts the session's token family.
+func (m TokenModel) NewAuthToken(user User, session *Session, ttlAccess, ttlRefresh time.Duration) (interface{}, error) {
+	accessToken, err := m.NewAccessToken(user, session, ttlAccess)
 
 	if err != nil || accessToken == "" {
 		return "", err
 	}
 
-	refreshToken, err := m.NewToken(user, TypeRefresh, ttlRefresh)
+	refreshToken, err := genereteToken(user.ID, TypeRefresh, ttlRefresh)
+	if err != nil {
+		return "", err
+	}
+	refreshToken.FamilyID = session.ID
+
+	err = m.Insert(refreshToken)
 	if err != nil {
 		return "", err
 	}
@@ -101,6 +189,69 @@ func (m TokenModel) NewAuthToken(user User, ttlAccess, ttlRefresh time.Duration)
 
 }
 
+// RotateAuthToken exchanges a refresh token for a new pair in the same family.
+// A refresh token can only be rotated once; presenting it again returns
+// ErrTokenReused and the caller is expected to revoke the family.
+//
+// The old token is marked exposed and its successor stored in one
+// transaction, after the access token is signed, so a failure part way
+// leaves the old token usable and the client's retry is not mistaken for
+// reuse.
+func (m TokenModel) RotateAuthToken(user User, session *Session, refreshToken *Token, ttlAccess, ttlRefresh time.Duration) (interface{}, error) {
+	accessToken, err := m.NewAccessToken(user, session, ttlAccess)
+	if err != nil {
+		return "", err
+	}
+
+	next, err := genereteToken(user.ID, TypeRefresh, ttlRefresh)
+	if err != nil {
+		return "", err
+	}
+	next.FamilyID = session.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tokens
+		SET is_exposed = true
+		WHERE hash = $1 AND is_exposed = false`
+	result, err := tx.ExecContext(ctx, query, refreshToken.Hash)
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		return "", ErrTokenReused
+	}
+
+	query = `
+		INSERT INTO tokens (hash, user_id, expiry, scope, family_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
+	_, err = tx.ExecContext(ctx, query, next.Hash, next.UserID, next.ExpiresAt, next.Scope, next.FamilyID)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken.IsExposed = true
+	return AuthToken{AccessToken: accessToken, RefreshToken: *next}, nil
+}
+
 func (m TokenModel) NewToken(user User, scope string, ttl time.Duration) (*Token, error) {
 
 	token, err := genereteToken(user.ID, scope, ttl)
@@ -117,30 +268,88 @@ func (m TokenModel) NewToken(user User, scope string, ttl time.Duration) (*Token
 }
 
 func (m TokenModel) Insert(token *Token) error {
-	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.UserID, token.ExpiresAt, token.Scope}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	return insertToken(ctx, m.DB, token)
+}
+
+// insertToken stores a token through db, which may be a transaction.
+func insertToken(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, family_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
+	args := []interface{}{token.Hash, token.UserID, token.ExpiresAt, token.Scope, token.FamilyID}
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
 
-func (m TokenModel) SetExposed(user *User) error {
-	query := `	UPDATE tokens 
-				SET is_exposed = true 
-				WHERE user_id = $1`
+// GetByPlaintext returns an unexpired token, including one that has already
+// been exposed, so that reuse of a rotated refresh token can be detected.
+func (m TokenModel) GetByPlaintext(scope, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT hash, user_id, expiry, scope, is_exposed, COALESCE(family_id, '')
+		FROM tokens
+		WHERE hash = $1
+		AND scope = $2
+		AND expiry > $3`
+
+	args := []interface{}{tokenHash[:], scope, time.Now()}
+	var token Token
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.ExpiresAt,
+		&token.Scope,
+		&token.IsExposed,
+		&token.FamilyID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	token.Plaintext = tokenPlaintext
+	return &token, nil
+}
+
+// SetExposed marks a token as used. It returns ErrTokenReused if the token had
+// already been marked, which also covers two requests racing with one token.
+func (m TokenModel) SetExposed(token *Token) error {
+	query := `
+		UPDATE tokens
+		SET is_exposed = true
+		WHERE hash = $1 AND is_exposed = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, token.Hash)
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.Exec(query, user)
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return ErrTokenReused
+	}
+
+	token.IsExposed = true
 	return nil
 }
 
 func (m TokenModel) GetAllForUser(user *User) ([]*Token, error) {
-	query := `SELECT hash, user_login, expiry, scope
+	query := `SELECT hash, user_id, expiry, scope, COALESCE(family_id, '')
 			FROM tokens
 			WHERE user_id = $1 
 			AND expiry > $2
@@ -158,7 +367,7 @@ func (m TokenModel) GetAllForUser(user *User) ([]*Token, error) {
 	var tokens []*Token
 	for rows.Next() {
 		var tempToken Token
-		err = rows.Scan(&tempToken.Hash, &tempToken.UserID, &tempToken.ExpiresAt, &tempToken.Scope)
+		err = rows.Scan(&tempToken.Hash, &tempToken.UserID, &tempToken.ExpiresAt, &tempToken.Scope, &tempToken.FamilyID)
 		if err != nil {
 			return nil, err
 		}
@@ -181,3 +390,63 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Consume deletes an unexpired token of the scope, for tokens that may only
+// be used once. It returns ErrRecordNotFound if there is no such token,
+// including when a concurrent request consumed it first.
+func (m TokenModel) Consume(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1
+		AND scope = $2
+		AND expiry > $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], scope, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m TokenModel) Delete(token *Token) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, token.Hash)
+	return err
+}
+
+// DeleteExpired deletes up to limit tokens that can no longer be used: expired
+// tokens, and exposed tokens outside any family. Exposed tokens in a family
+// are kept until they expire because they are what reveals a replayed
+// refresh token.
+func (m TokenModel) DeleteExpired(limit int) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE hash IN (
+			SELECT hash FROM tokens
+			WHERE expiry < $1
+			OR (is_exposed = true AND family_id IS NULL)
+			LIMIT $2
+		)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/totp"
+)
+
+const (
+	// maxTOTPFailures is how many wrong second factors a user may give
+	// within TOTPFailureWindow before two-factor authentication locks until
+	// the window is over. Logging in with the password again does not reset
+	// the count, so guessing stays this slow however often it is retried.
+	maxTOTPFailures   = 10
+	TOTPFailureWindow = 24 * time.Hour
+)
+
+var (
+	ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPLocked  = errors.New("too many failed two-factor attempts")
+)
+
+// TOTP is a user's authenticator app enrollment. It only counts as a second
+// factor once Confirmed, which happens when the user proves the app
+// generates the right codes.
+type TOTP struct {
+	UserID         int64
+	Secret         []byte
+	Confirmed      bool
+	LastUsedStep   int64
+	FailedAttempts int
+	FailuresSince  time.Time
+	CreatedAt      time.Time
+}
+
+// Locked reports whether the user has given too many wrong second factors
+// lately for any more to be checked.
+func (t *TOTP) Locked(now time.Time) bool {
+	return t.FailedAttempts >= maxTOTPFailures && now.Before(t.FailuresSince.Add(TOTPFailureWindow))
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+func (m TOTPModel) Get(userID int64) (*TOTP, error) {
+	query := `
+		SELECT user_id, secret, confirmed, last_used_step, failed_attempts, failures_since, created_at
+		FROM user_totp
+		WHERE user_id = $1`
+
+	var t TOTP
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.Confirmed,
+		&t.LastUsedStep,
+		&t.FailedAttempts,
+		&t.FailuresSince,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// IsEnabled reports whether the user has a confirmed enrollment, in which
+// case logging in takes a code as well as the password.
+func (m TOTPModel) IsEnabled(userID int64) (bool, error) {
+	t, err := m.Get(userID)
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return t.Confirmed, nil
+}
+
+// Enroll stores a new secret for the user, replacing an enrollment that was
+// never confirmed. It returns ErrTOTPEnabled if one was.
+func (m TOTPModel) Enroll(userID int64, secret []byte) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, failed_attempts = 0, created_at = NOW()
+		WHERE user_totp.confirmed = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (m TOTPModel) Confirm(userID int64) error {
+	query := `
+		UPDATE user_totp
+		SET confirmed = true
+		WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Verify checks a code. A code is accepted once: its time step has to be
+// later than the last one used, so a code seen over someone's shoulder is
+// worthless. A wrong code counts towards FailedAttempts, and a right one
+// resets it. It returns ErrTOTPLocked without looking at the code if the
+// user is locked out.
+func (m TOTPModel) Verify(t *TOTP, code string) (bool, error) {
+	now := time.Now()
+	if t.Locked(now) {
+		return false, ErrTOTPLocked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	step, ok := totp.Validate(t.Secret, code, now)
+	if ok {
+		query := `
+			UPDATE user_totp
+			SET last_used_step = $2, failed_attempts = 0
+			WHERE user_id = $1 AND last_used_step < $2`
+		result, err := m.DB.ExecContext(ctx, query, t.UserID, step)
+		if err != nil {
+			return false, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if rows == 1 {
+			t.LastUsedStep = step
+			t.FailedAttempts = 0
+			return true, nil
+		}
+	}
+
+	return false, m.RecordFailure(t)
+}
+
+// RecordFailure counts a wrong second factor, such as a wrong recovery code,
+// towards FailedAttempts. The count starts over at the first failure after
+// TOTPFailureWindow has passed since FailuresSince.
+func (m TOTPModel) RecordFailure(t *TOTP) error {
+	query := `
+		UPDATE user_totp
+		SET failed_attempts = CASE WHEN failures_since > $2 THEN failed_attempts + 1 ELSE 1 END,
+			failures_since = CASE WHEN failures_since > $2 THEN failures_since ELSE $3 END
+		WHERE user_id = $1
+		RETURNING failed_attempts, failures_since`
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, t.UserID, now.Add(-TOTPFailureWindow), now).Scan(&t.FailedAttempts, &t.FailuresSince)
+}
+
+func (m TOTPModel) Delete(userID int64) error {
+	query := `
+		DELETE FROM user_totp
+		WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/binsabit/authorization_practice/internal/data/validator"
@@ -13,6 +14,10 @@ import (
 
 var (
 	ErrDuplicateLogin = errors.New("duplicate login")
+	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicatePhone = errors.New("duplicate phone")
+	ErrEditConflict   = errors.New("edit conflict")
+	ErrUnknownRole    = errors.New("unknown role")
 )
 var AnonymousUser = &User{}
 
@@ -20,10 +25,17 @@ type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	Login     string    `json:"login"`
-	Password  password  `json:"."`
-	Status    string    `json:"status"`
-	Role      string    `json:"role"`
-	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	// PhoneVerified is set once the user has entered a code sent to Phone.
+	// Until then the number cannot be used to log in, and other accounts
+	// may give the same one.
+	PhoneVerified bool     `json:"phone_verified"`
+	Password      password `json:"-"`
+	Status        string   `json:"status"`
+	Role          string   `json:"role"`
+	Name          string   `json:"name"`
+	Version       int      `json:"version"`
 }
 
 type password struct {
@@ -39,6 +51,33 @@ func ValidateLogin(v *validator.Validator, login string) {
 	v.Check(login != "", "login", "must be provided")
 	v.Check(len(login) >= 5, "login", "must be at least 5 bytes long")
 }
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+// NormalizePhone strips the spaces, dashes, dots and parentheses people
+// write phone numbers with, leaving digits and a leading plus.
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func ValidatePhone(v *validator.Validator, phone string) {
+	v.Check(phone != "", "phone", "must be provided")
+	v.Check(validator.Matches(phone, validator.PhoneRX), "phone", "must be a valid phone number")
+	digits := strings.TrimPrefix(NormalizePhone(phone), "+")
+	v.Check(len(digits) >= 7 && len(digits) <= 15, "phone", "must have between 7 and 15 digits")
+}
+
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
@@ -46,6 +85,11 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 func ValidateUser(v *validator.Validator, user *User) {
 
 	ValidateLogin(v, user.Login)
+	ValidateEmail(v, user.Email)
+
+	if user.Phone != "" {
+		ValidatePhone(v, user.Phone)
+	}
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -83,19 +127,32 @@ type UserModel struct {
 }
 
 func (m UserModel) Insert(user *User) error {
-	query := `
-			INSERT INTO users (login, password_hash, role, status, name)
-			VALUES ($1,$2,$3,$4,$5)
-			RETURNING id, created_at`
-	args := []interface{}{user.Login, user.Password.hash, user.Role, user.Status, user.Name}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+	return insertUser(ctx, m.DB, user)
+}
+
+// insertUser is Insert on db or on a transaction.
+func insertUser(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, user *User) error {
+	user.Phone = NormalizePhone(user.Phone)
+
+	query := `
+			INSERT INTO users (login, email, phone, password_hash, role, status, name)
+			VALUES ($1,$2,NULLIF($3, ''),$4,$5,$6,$7)
+			RETURNING id, created_at, version`
+	args := []interface{}{user.Login, user.Email, user.Phone, user.Password.hash, user.Role, user.Status, user.Name}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateLogin
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_unique_idx"`:
+			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_phone_unique_idx"`:
+			return ErrDuplicatePhone
 		default:
 			return err
 		}
@@ -105,7 +162,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByLogin(login string) (*User, error) {
 	query := `
-		SELECT id, created_at, login, password_hash, name,status, role
+		SELECT id, created_at, login, COALESCE(email, ''), COALESCE(phone, ''), phone_verified, password_hash, name, status, role, version
 		FROM users
 		WHERE login = $1`
 	var user User
@@ -115,10 +172,79 @@ func (m UserModel) GetByLogin(login string) (*User, error) {
 		&user.ID,
 		&user.CreatedAt,
 		&user.Login,
+		&user.Email,
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Password.hash,
+		&user.Name,
+		&user.Status,
+		&user.Role,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+func (m UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, created_at, login, COALESCE(email, ''), COALESCE(phone, ''), phone_verified, password_hash, name, status, role, version
+		FROM users
+		WHERE lower(email) = lower($1)`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Login,
+		&user.Email,
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Password.hash,
+		&user.Name,
+		&user.Status,
+		&user.Role,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetByPhone looks a user up by verified phone number, however it was
+// written.
+func (m UserModel) GetByPhone(phone string) (*User, error) {
+	query := `
+		SELECT id, created_at, login, COALESCE(email, ''), COALESCE(phone, ''), phone_verified, password_hash, name, status, role, version
+		FROM users
+		WHERE phone = $1 AND phone_verified`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, NormalizePhone(phone)).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Login,
+		&user.Email,
+		&user.Phone,
+		&user.PhoneVerified,
 		&user.Password.hash,
 		&user.Name,
 		&user.Status,
 		&user.Role,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -132,7 +258,7 @@ func (m UserModel) GetByLogin(login string) (*User, error) {
 }
 func (m UserModel) GetByID(ID int64) (*User, error) {
 	query := `
-		SELECT id, created_at, login, password_hash, name,status, role
+		SELECT id, created_at, login, COALESCE(email, ''), COALESCE(phone, ''), phone_verified, password_hash, name, status, role, version
 		FROM users
 		WHERE id = $1`
 	var user User
@@ -142,10 +268,14 @@ func (m UserModel) GetByID(ID int64) (*User, error) {
 		&user.ID,
 		&user.CreatedAt,
 		&user.Login,
+		&user.Email,
+		&user.Phone,
+		&user.PhoneVerified,
 		&user.Password.hash,
 		&user.Name,
 		&user.Status,
 		&user.Role,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -163,7 +293,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT users.id, users.created_at, users.login, users.password_hash
+		SELECT users.id, users.created_at, users.login, COALESCE(users.email, ''), COALESCE(users.phone, ''), users.phone_verified, users.password_hash, users.name, users.status, users.role, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -180,7 +310,14 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.ID,
 		&user.CreatedAt,
 		&user.Login,
+		&user.Email,
+		&user.Phone,
+		&user.PhoneVerified,
 		&user.Password.hash,
+		&user.Name,
+		&user.Status,
+		&user.Role,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -192,3 +329,48 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	}
 	return &user, nil
 }
+
+// Update saves the user if nobody else has changed it since it was read,
+// otherwise it returns ErrEditConflict.
+func (m UserModel) Update(user *User) error {
+	user.Phone = NormalizePhone(user.Phone)
+
+	query := `
+		UPDATE users
+		SET login = $1, email = NULLIF($2, ''), phone = NULLIF($9, ''), phone_verified = $10, password_hash = $3, name = $4, status = $5, role = $6, version = version + 1
+		WHERE id = $7 AND version = $8
+		RETURNING version`
+	args := []interface{}{
+		user.Login,
+		user.Email,
+		user.Password.hash,
+		user.Name,
+		user.Status,
+		user.Role,
+		user.ID,
+		user.Version,
+		user.Phone,
+		user.PhoneVerified,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: insert or update on table "users" violates foreign key constraint "users_role_fkey"`:
+			return ErrUnknownRole
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateLogin
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_unique_idx"`:
+			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_phone_unique_idx"`:
+			return ErrDuplicatePhone
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/webauthn"
+	"github.com/lib/pq"
+)
+
+// WebAuthn ceremonies a challenge can be issued for.
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+var (
+	ErrDuplicateCredential = errors.New("credential already registered")
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// PublicKey is the COSE key the authenticator signs assertions with, and
+// SignCount the last signature counter it reported.
+type WebAuthnCredential struct {
+	ID              webauthn.Bytes `json:"id"`
+	UserID          int64          `json:"-"`
+	Name            string         `json:"name"`
+	PublicKey       []byte         `json:"-"`
+	SignCount       uint32         `json:"-"`
+	AAGUID          webauthn.Bytes `json:"aaguid"`
+	AttestationType string         `json:"attestation_type"`
+	Transports      []string       `json:"transports"`
+	CreatedAt       time.Time      `json:"created_at"`
+	LastUsedAt      *time.Time     `json:"last_used_at"`
+}
+
+// Descriptor returns how the credential is named to the browser in
+// ceremony options.
+func (c *WebAuthnCredential) Descriptor() webauthn.CredentialDescriptor {
+	return webauthn.CredentialDescriptor{Type: "public-key", ID: c.ID, Transports: c.Transports}
+}
+
+// WebAuthnModel stores users' credentials and the challenges of ceremonies
+// in progress. Like tokens, challenges are kept as SHA-256 hashes.
+type WebAuthnModel struct {
+	DB *sql.DB
+}
+
+// NewChallenge issues a challenge for a ceremony. userID is zero for a login
+// where the user has not said who they are and picks a discoverable
+// credential.
+func (m WebAuthnModel) NewChallenge(userID int64, ceremony string) (webauthn.Bytes, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(challenge)
+
+	query := `
+		INSERT INTO webauthn_challenges (hash, user_id, ceremony, expiry)
+		VALUES ($1, $2, $3, $4)`
+	args := []interface{}{hash[:], sql.NullInt64{Int64: userID, Valid: userID != 0}, ceremony, time.Now().Add(webauthn.Timeout)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ConsumeChallenge uses up a challenge issued for the ceremony and returns
+// the user it was issued to, or zero if it was issued to nobody in
+// particular. It returns ErrRecordNotFound if the challenge is unknown,
+// expired or already used.
+func (m WebAuthnModel) ConsumeChallenge(challenge []byte, ceremony string) (int64, error) {
+	hash := sha256.Sum256(challenge)
+
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE hash = $1 AND ceremony = $2 AND expiry > $3
+		RETURNING user_id`
+
+	var userID sql.NullInt64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, hash[:], ceremony, time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID.Int64, nil
+}
+
+// DeleteExpiredChallenges deletes up to limit challenges of ceremonies that
+// were abandoned.
+func (m WebAuthnModel) DeleteExpiredChallenges(limit int) (int64, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE hash IN (
+			SELECT hash FROM webauthn_challenges
+			WHERE expiry < $1
+			LIMIT $2
+		)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (m WebAuthnModel) Insert(cred *WebAuthnCredential) error {
+	query := `
+		INSERT INTO webauthn_credentials (id, user_id, name, public_key, sign_count, aaguid, attestation_type, transports)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`
+	args := []interface{}{
+		[]byte(cred.ID),
+		cred.UserID,
+		cred.Name,
+		cred.PublicKey,
+		int64(cred.SignCount),
+		[]byte(cred.AAGUID),
+		cred.AttestationType,
+		pq.Array(cred.Transports),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&cred.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "webauthn_credentials_pkey"`:
+			return ErrDuplicateCredential
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+const webAuthnCredentialColumns = `
+	id, user_id, name, public_key, sign_count, aaguid, attestation_type, transports, created_at, last_used_at`
+
+func scanWebAuthnCredential(row interface{ Scan(...interface{}) error }) (*WebAuthnCredential, error) {
+	var cred WebAuthnCredential
+	var signCount int64
+	err := row.Scan(
+		(*[]byte)(&cred.ID),
+		&cred.UserID,
+		&cred.Name,
+		&cred.PublicKey,
+		&signCount,
+		(*[]byte)(&cred.AAGUID),
+		&cred.AttestationType,
+		pq.Array(&cred.Transports),
+		&cred.CreatedAt,
+		&cred.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	cred.SignCount = uint32(signCount)
+	return &cred, nil
+}
+
+func (m WebAuthnModel) Get(id []byte) (*WebAuthnCredential, error) {
+	query := `
+		SELECT` + webAuthnCredentialColumns + `
+		FROM webauthn_credentials
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return scanWebAuthnCredential(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetAllForUser returns the user's credentials, oldest first.
+func (m WebAuthnModel) GetAllForUser(userID int64) ([]*WebAuthnCredential, error) {
+	query := `
+		SELECT` + webAuthnCredentialColumns + `
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creds := []*WebAuthnCredential{}
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// RecordUse stores the signature counter of a successful assertion. The
+// update only applies if the stored counter is still the one the assertion
+// was checked against; otherwise the credential was used concurrently and
+// ErrEditConflict is returned.
+func (m WebAuthnModel) RecordUse(cred *WebAuthnCredential, signCount uint32) error {
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $3, last_used_at = NOW()
+		WHERE id = $1 AND sign_count = $2
+		RETURNING last_used_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, []byte(cred.ID), int64(cred.SignCount), int64(signCount)).Scan(&cred.LastUsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	cred.SignCount = signCount
+	return nil
+}
+
+// Delete removes one of the user's credentials. It returns ErrRecordNotFound
+// if the user has no credential with that ID.
+func (m WebAuthnModel) Delete(userID int64, id []byte) error {
+	query := `
+		DELETE FROM webauthn_credentials
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -59,3 +59,53 @@ func AuthenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	errorResponse(w, r, http.StatusUnauthorized, message)
 }
+
+func NotPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func OrganizationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource belongs to an organization, exchange your token for one issued in it first"
+	errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func EditConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	errorResponse(w, r, http.StatusConflict, message)
+}
+
+func TooManyAttemptsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many failed attempts, please try again later"
+	errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func InactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func AccountSuspendedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been suspended"
+	errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// OAuthErrorResponse writes an error in the format of RFC 6749 section 5.2,
+// which the OAuth endpoints use instead of the usual error envelope.
+func OAuthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	env := Envelope{"error": code}
+	if description != "" {
+		env["error_description"] = description
+	}
+
+	err := WriteJSON(w, status, env, nil)
+	if err != nil {
+		logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+func InvalidClientResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	OAuthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+}
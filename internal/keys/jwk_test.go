@@ -0,0 +1,77 @@
+package keys
+
+import "testing"
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 7638 section 3.1.
+			name: "RSA",
+			jwk: JWK{
+				Kty: "RSA",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+				Alg: "RS256",
+				Kid: "2011-04-29",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037 appendix A.3.
+			name: "Ed25519",
+			jwk: JWK{
+				Kty: "OKP",
+				Crv: "Ed25519",
+				X:   "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+			},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := thumbprint(tt.jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("thumbprint = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbprintIgnoresOptionalMembers(t *testing.T) {
+	jwk := JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU",
+		Y:   "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0",
+	}
+	want, err := thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk.Use, jwk.Alg, jwk.Kid = "sig", "ES256", "some-key"
+	got, err := thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("thumbprint with use, alg and kid = %q, want %q", got, want)
+	}
+
+	jwk.Y = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	other, err := thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == want {
+		t.Error("thumbprint does not depend on y")
+	}
+}
@@ -0,0 +1,267 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pemType       = "PRIVATE KEY"
+	createdHeader = "Created"
+)
+
+type Options struct {
+	Algorithm string
+	// RotateEvery is the age at which the active key is replaced. Zero
+	// disables scheduled rotation.
+	RotateEvery time.Duration
+	// Propagation is how long a new key is published in the JWKS before it
+	// is used for signing, so that verifiers caching the JWKS pick it up.
+	Propagation time.Duration
+	// Retention is how long a retired key keeps verifying tokens. It must
+	// be at least the lifetime of an access token.
+	Retention time.Duration
+}
+
+// Keyring holds the signing keys stored in a directory, one PEM file per key.
+// The newest published key signs new tokens while the keys it replaced keep
+// verifying until the tokens they signed have expired.
+type Keyring struct {
+	dir  string
+	opts Options
+
+	mu     sync.RWMutex
+	keys   []*Key
+	active *Key
+}
+
+// Open loads every key in dir and picks the active signing key. A new key is
+// generated if there is none for the configured algorithm yet.
+func Open(dir string, opts Options) (*Keyring, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	kr := &Keyring{dir: dir, opts: opts}
+
+	err = kr.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if kr.Active() == nil {
+		_, err = kr.Rotate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (kr *Keyring) Active() *Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active
+}
+
+// Lookup returns the verification key with the given kid.
+func (kr *Keyring) Lookup(kid string) (*Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	for _, key := range kr.keys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// JWKS returns the public keys that verify tokens, newest first.
+func (kr *Keyring) JWKS() []JWK {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	jwks := make([]JWK, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		jwks = append(jwks, key.JWK())
+	}
+	return jwks
+}
+
+// Rotate generates a new key. It is published straight away and takes over
+// signing once the propagation delay has passed.
+func (kr *Keyring) Rotate() (*Key, error) {
+	key, err := Generate(kr.opts.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = kr.save(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, kr.Reload()
+}
+
+// RotateIfDue rotates when the active key is older than RotateEvery and no
+// newer key is already waiting to take over.
+func (kr *Keyring) RotateIfDue() (bool, error) {
+	if kr.opts.RotateEvery <= 0 {
+		return false, nil
+	}
+
+	kr.mu.RLock()
+	active := kr.active
+	pending := len(kr.keys) > 0 && kr.keys[0] != active
+	kr.mu.RUnlock()
+
+	if pending || time.Since(active.CreatedAt) < kr.opts.RotateEvery {
+		return false, nil
+	}
+
+	_, err := kr.Rotate()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reload re-reads the key directory, so keys rotated by another process are
+// picked up, and deletes keys whose retention has passed.
+func (kr *Keyring) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	var all []*Key
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", path, err)
+		}
+		all = append(all, key)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+
+	now := time.Now()
+	active := -1
+	for i, key := range all {
+		if key.Algorithm == kr.opts.Algorithm && !key.CreatedAt.Add(kr.opts.Propagation).After(now) {
+			active = i
+			break
+		}
+	}
+	if active == -1 {
+		// Nothing has been published long enough, so fall back to the key
+		// that has been published the longest.
+		for i := len(all) - 1; i >= 0; i-- {
+			if all[i].Algorithm == kr.opts.Algorithm {
+				active = i
+				break
+			}
+		}
+	}
+
+	keys := all
+	if active != -1 {
+		keys = all[:active+1]
+		for i := active + 1; i < len(all); i++ {
+			// A key was retired when the key created after it took over.
+			retiredAt := all[i-1].CreatedAt.Add(kr.opts.Propagation)
+			if retiredAt.Add(kr.opts.Retention).After(now) {
+				keys = append(keys, all[i])
+				continue
+			}
+
+			err = os.Remove(filepath.Join(kr.dir, all[i].ID+".pem"))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kr.keys = keys
+	kr.active = nil
+	if active != -1 {
+		kr.active = all[active]
+	}
+
+	return nil
+}
+
+func (kr *Keyring) save(key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+
+	block := &pem.Block{
+		Type:    pemType,
+		Headers: map[string]string{createdHeader: key.CreatedAt.Format(time.RFC3339Nano)},
+		Bytes:   der,
+	}
+
+	path := filepath.Join(kr.dir, key.ID+".pem")
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func readKey(path string) (*Key, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != pemType {
+		return nil, errors.New("no PKCS #8 private key found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, parsed)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(block.Headers[createdHeader]))
+	if err != nil {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return nil, statErr
+		}
+		createdAt = info.ModTime().UTC()
+	}
+
+	return newKey(signer, createdAt)
+}
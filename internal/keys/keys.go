@@ -0,0 +1,117 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyNotFound          = errors.New("signing key not found")
+)
+
+// Key is an asymmetric signing key. Only the public half ever leaves the
+// process, through JWK.
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+func Generate(alg string) (*Key, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch alg {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(signer, time.Now().UTC())
+}
+
+func newKey(signer crypto.Signer, createdAt time.Time) (*Key, error) {
+	alg, err := algorithmFor(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Algorithm: alg,
+		CreatedAt: createdAt,
+		private:   signer,
+	}
+
+	key.ID, err = thumbprint(key.JWK())
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func algorithmFor(signer crypto.Signer) (string, error) {
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("%w: ecdsa curve %s", ErrUnsupportedAlgorithm, k.Curve.Params().Name)
+		}
+		return AlgES256, nil
+	case ed25519.PrivateKey:
+		return AlgEdDSA, nil
+	default:
+		return "", fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, signer)
+	}
+}
+
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// SigningKey returns the private key in the form the jwt signing methods expect.
+func (k *Key) SigningKey() interface{} {
+	return k.private
+}
+
+func (k *Key) PublicKey() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Sign creates a JWT for claims with the kid header set to this key.
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(k.SigningMethod(), claims)
+	t.Header["kid"] = k.ID
+
+	return t.SignedString(k.SigningKey())
+}
@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer delivers the email rendered from a template in templates/. Each
+// template defines a "subject" and a "plainBody" block.
+type Mailer interface {
+	Send(recipient, templateFile string, data interface{}) error
+}
+
+type message struct {
+	to      string
+	subject string
+	body    string
+}
+
+func render(recipient, templateFile string, data interface{}) (*message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(body, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{
+		to:      recipient,
+		subject: strings.TrimSpace(subject.String()),
+		body:    body.String(),
+	}, nil
+}
+
+func (msg *message) bytes(sender string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", sender)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.to)
+	fmt.Fprintf(buf, "Subject: %s\r\n", msg.subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTP sends mail through an SMTP server using PLAIN authentication.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+func (m SMTP) Send(recipient, templateFile string, data interface{}) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	return m.send(msg)
+}
+
+// SendText sends a plain-text message that does not come from a template,
+// such as a one-time passcode.
+func (m SMTP) SendText(recipient, subject, body string) error {
+	return m.send(&message{to: recipient, subject: subject, body: body})
+}
+
+func (m SMTP) send(msg *message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.Sender, []string{msg.to}, msg.bytes(m.Sender))
+}
+
+// File writes each message to its own .eml file in Dir, for local development.
+type File struct {
+	Dir    string
+	Sender string
+}
+
+func (m File) Send(recipient, templateFile string, data interface{}) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), strings.TrimSuffix(templateFile, ".tmpl"))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.bytes(m.Sender), 0o600)
+}
+
+// Log prints each message to Logger, for local development and tests.
+type Log struct {
+	Logger *log.Logger
+}
+
+func (m Log) Send(recipient, templateFile string, data interface{}) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.Logger.Printf("mail to %s: %s\n%s", msg.to, msg.subject, msg.body)
+	return nil
+}
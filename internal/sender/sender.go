@@ -0,0 +1,90 @@
+// Package sender delivers short text messages, such as one-time passcodes,
+// by SMS or email. Carriers plug in behind the Sender interface; File and Log
+// let the flows that use it run locally without any.
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/binsabit/authorization_practice/internal/mailer"
+)
+
+// Channels a message can be sent over.
+const (
+	ChannelSMS   = "sms"
+	ChannelEmail = "email"
+)
+
+var ErrUnsupportedChannel = errors.New("sender: unsupported channel")
+
+// Message is a text message for a phone number or an email address,
+// depending on Channel.
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Body    string `json:"body"`
+}
+
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTP sends messages as plain-text email through Mailer. SMS goes through
+// an email-to-SMS gateway: a message for +15551234567 is mailed to
+// +15551234567@<SMSGateway>. Without a gateway only email is supported.
+type SMTP struct {
+	Mailer     mailer.SMTP
+	Subject    string
+	SMSGateway string
+}
+
+func (s SMTP) Send(msg Message) error {
+	var recipient string
+	switch {
+	case msg.Channel == ChannelEmail:
+		recipient = msg.To
+	case msg.Channel == ChannelSMS && s.SMSGateway != "":
+		recipient = msg.To + "@" + s.SMSGateway
+	default:
+		return fmt.Errorf("%w %q", ErrUnsupportedChannel, msg.Channel)
+	}
+
+	return s.Mailer.SendText(recipient, s.Subject, msg.Body)
+}
+
+// File writes each message as JSON to its own file in Dir, for local
+// development and tests.
+type File struct {
+	Dir string
+}
+
+func (s File) Send(msg Message) error {
+	b, err := json.MarshalIndent(msg, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.json", time.Now().UTC().Format("20060102T150405.000000000"), msg.Channel)
+	return os.WriteFile(filepath.Join(s.Dir, name), b, 0o600)
+}
+
+// Log prints each message to Logger, for local development and tests.
+type Log struct {
+	Logger *log.Logger
+}
+
+func (s Log) Send(msg Message) error {
+	s.Logger.Printf("%s to %s: %s", msg.Channel, msg.To, msg.Body)
+	return nil
+}
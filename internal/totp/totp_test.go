@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B gives eight digit codes; six digit codes are
+	// their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got := Code(rfc6238Secret, Step(time.Unix(tt.unix, 0)))
+		if got != tt.want {
+			t.Errorf("Code at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", Code(rfc6238Secret, current), current, true},
+		{"previous step", Code(rfc6238Secret, current-1), current - 1, true},
+		{"next step", Code(rfc6238Secret, current+1), current + 1, true},
+		{"with a space", "050 471", current, true},
+		{"two steps ago", Code(rfc6238Secret, current-2), 0, false},
+		{"two steps ahead", Code(rfc6238Secret, current+2), 0, false},
+		{"empty", "", 0, false},
+		{"too short", "05047", 0, false},
+		{"too long", "0504710", 0, false},
+		{"eight digits", "14050471", 0, false},
+		{"not digits", "abcdef", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfc6238Secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Example Co", "alice@example.com", rfc6238Secret)
+	want := "otpauth://totp/Example%20Co:alice@example.com?algorithm=SHA1&digits=6&issuer=Example+Co&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if got != want {
+		t.Errorf("URI = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Assertion is the response to navigator.credentials.get().
+type Assertion struct {
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+// VerifyAssertion checks an assertion made with a stored credential for the
+// challenge the server issued, and returns the authenticator's new signature
+// counter. Authenticators that keep no counter always report zero; any other
+// counter has to be greater than the one stored, or ErrSignCount is
+// returned.
+func (c Config) VerifyAssertion(challenge []byte, publicKey []byte, signCount uint32, a Assertion) (uint32, error) {
+	err := c.verifyClientData(a.ClientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(a.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	err = c.verifyAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+
+	pub, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	signed := append(append([]byte(nil), a.AuthenticatorData...), clientDataHash[:]...)
+	err = pub.Verify(signed, a.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	if (authData.SignCount != 0 || signCount != 0) && authData.SignCount <= signCount {
+		return 0, fmt.Errorf("%w: got %d, stored %d", ErrSignCount, authData.SignCount, signCount)
+	}
+	return authData.SignCount, nil
+}
@@ -0,0 +1,154 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// errCBOR is returned for CBOR this decoder does not understand. It covers
+// what authenticators produce: definite-length integers, byte and text
+// strings, arrays, maps and simple values.
+var errCBOR = fmt.Errorf("%w: malformed CBOR", ErrVerification)
+
+// maxCBORDepth bounds nesting so a hostile attestation object cannot exhaust
+// the stack.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item in b and returns it along with the
+// bytes that follow it. Unsigned integers decode to uint64, negative ones to
+// int64, byte strings to []byte, text strings to string, arrays to
+// []interface{} and maps to map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth || len(b) == 0 {
+		return nil, nil, errCBOR
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22, 23:
+			return nil, b, nil
+		default:
+			return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+		}
+	}
+
+	arg, b, err := cborArgument(info, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		return arg, b, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(arg), b, nil
+	case 2, 3:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		value := b[:arg]
+		if major == 3 {
+			return string(value), b[arg:], nil
+		}
+		return append([]byte(nil), value...), b[arg:], nil
+	case 4:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case uint64, int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			value, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, b, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+	}
+}
+
+// cborArgument reads the argument that follows an initial byte. Indefinite
+// lengths are rejected; WebAuthn requires canonical CBOR, which has none.
+func cborArgument(info byte, b []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), b, nil
+	case info == 24 && len(b) >= 1:
+		return uint64(b[0]), b[1:], nil
+	case info == 25 && len(b) >= 2:
+		return uint64(binary.BigEndian.Uint16(b)), b[2:], nil
+	case info == 26 && len(b) >= 4:
+		return uint64(binary.BigEndian.Uint32(b)), b[4:], nil
+	case info == 27 && len(b) >= 8:
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	default:
+		return 0, nil, errCBOR
+	}
+}
+
+// cborInt returns the integer stored under an integer key, whichever sign
+// either was encoded with.
+func cborInt(m map[interface{}]interface{}, key int64) (int64, bool) {
+	switch v := m[cborKey(key)].(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// cborKey looks a map up by an integer key, which decodes as uint64 when
+// positive and int64 when negative.
+func cborKey(k int64) interface{} {
+	if k >= 0 {
+		return uint64(k)
+	}
+	return k
+}
@@ -0,0 +1,134 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 8949 appendix A.
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", uint64(0)},
+		{"17", uint64(23)},
+		{"1818", uint64(24)},
+		{"1903e8", uint64(1000)},
+		{"1a000f4240", uint64(1000000)},
+		{"1b000000e8d4a51000", uint64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"40", []byte(nil)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"80", []interface{}{}},
+		{"83010203", []interface{}{uint64(1), uint64(2), uint64(3)}},
+		{"8301820203820405", []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}}},
+		{"a0", map[interface{}]interface{}{}},
+		{"a201020304", map[interface{}]interface{}{uint64(1): uint64(2), uint64(3): uint64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+	}
+
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		got, rest, err := decodeCBOR(b)
+		if err != nil {
+			t.Errorf("decodeCBOR(%s): %v", tt.hex, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("decodeCBOR(%s) left %x", tt.hex, rest)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%s) = %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCBORRest(t *testing.T) {
+	got, rest, err := decodeCBOR([]byte{0x01, 0x02, 0x03})
+	if err != nil || got != uint64(1) || !reflect.DeepEqual(rest, []byte{0x02, 0x03}) {
+		t.Errorf("decodeCBOR = %v, %x, %v, want 1, 0203, nil", got, rest, err)
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	deep := make([]byte, maxCBORDepth+2)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+
+	tests := []struct {
+		name string
+		hex  string
+		b    []byte
+	}{
+		{name: "empty", hex: ""},
+		{name: "truncated argument", hex: "19e8"},
+		{name: "reserved argument", hex: "1c"},
+		{name: "indefinite byte string", hex: "5f42010243030405ff"},
+		{name: "indefinite array", hex: "9f0102ff"},
+		{name: "byte string past the end", hex: "44010203"},
+		{name: "text string past the end", hex: "64494554"},
+		{name: "array longer than the input", hex: "8301"},
+		{name: "map longer than the input", hex: "a201"},
+		{name: "map missing a value", hex: "a101"},
+		{name: "huge length", hex: "5bffffffffffffffff"},
+		{name: "negative integer out of range", hex: "3bffffffffffffffff"},
+		{name: "array map key", hex: "a1800102"},
+		{name: "tag", hex: "c11a514b67b0"},
+		{name: "float", hex: "f93c00"},
+		{name: "too deep", b: deep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.b
+			if b == nil {
+				b, _ = hex.DecodeString(tt.hex)
+			}
+			_, _, err := decodeCBOR(b)
+			if !errors.Is(err, ErrVerification) {
+				t.Errorf("decodeCBOR(%x) error = %v, want ErrVerification", b, err)
+			}
+		})
+	}
+}
+
+func TestCBORInt(t *testing.T) {
+	m := map[interface{}]interface{}{
+		uint64(1):  uint64(2),
+		uint64(3):  int64(-7),
+		int64(-1):  uint64(1),
+		int64(-2):  []byte{1},
+		uint64(10): uint64(1 << 63),
+	}
+
+	tests := []struct {
+		key    int64
+		want   int64
+		wantOK bool
+	}{
+		{1, 2, true},
+		{3, -7, true},
+		{-1, 1, true},
+		{-2, 0, false},
+		{10, 0, false},
+		{4, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := cborInt(m, tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("cborInt(%d) = %d, %v, want %d, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
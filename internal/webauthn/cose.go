@@ -0,0 +1,176 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers, from the IANA COSE Algorithms registry.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// Algorithms lists the signature algorithms accepted for credentials, in
+// order of preference.
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+var ErrUnsupportedKey = errors.New("webauthn: unsupported public key")
+
+// COSE key parameters used by the supported key types.
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// PublicKey is a credential public key decoded from its COSE encoding.
+type PublicKey struct {
+	Algorithm int64
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key, as stored for a credential.
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	key, rest, err := parsePublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrUnsupportedKey)
+	}
+	return key, nil
+}
+
+// parsePublicKey decodes the COSE_Key at the start of b and returns the
+// bytes after it, since in authenticator data extensions may follow the key.
+func parsePublicKey(b []byte) (*PublicKey, []byte, error) {
+	item, rest, err := decodeCBOR(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, ErrUnsupportedKey
+	}
+
+	kty, _ := cborInt(m, coseKty)
+	alg, _ := cborInt(m, coseAlg)
+	crv, _ := cborInt(m, coseCrv)
+
+	pub := &PublicKey{Algorithm: alg}
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256 && crv == coseCrvP256:
+		x, okX := m[cborKey(coseX)].([]byte)
+		y, okY := m[cborKey(coseY)].([]byte)
+		if !okX || !okY || len(x) != 32 || len(y) != 32 {
+			return nil, nil, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, nil, fmt.Errorf("%w: point is not on the curve", ErrUnsupportedKey)
+		}
+		pub.key = key
+	case kty == coseKtyOKP && alg == AlgEdDSA && crv == coseCrvEd25519:
+		x, ok := m[cborKey(coseX)].([]byte)
+		if !ok || len(x) != ed25519.PublicKeySize {
+			return nil, nil, ErrUnsupportedKey
+		}
+		pub.key = ed25519.PublicKey(x)
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, okN := m[cborKey(coseN)].([]byte)
+		e, okE := m[cborKey(coseE)].([]byte)
+		if !okN || !okE || len(e) == 0 || len(e) > 4 {
+			return nil, nil, ErrUnsupportedKey
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, nil, fmt.Errorf("%w: RSA key shorter than 2048 bits", ErrUnsupportedKey)
+		}
+		pub.key = key
+	default:
+		return nil, nil, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupportedKey, kty, alg)
+	}
+
+	return pub, rest, nil
+}
+
+// Verify checks a signature made with the key over message.
+func (k *PublicKey) Verify(message, sig []byte) error {
+	return verifySignature(k.key, k.Algorithm, message, sig)
+}
+
+// verifySignature checks sig over message with key, which alg says how to
+// use. It also serves attestation certificates, whose keys come from X.509.
+func verifySignature(key crypto.PublicKey, alg int64, message, sig []byte) error {
+	switch alg {
+	case AlgES256:
+		key, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return fmt.Errorf("%w: bad signature", ErrVerification)
+		}
+		return nil
+	case AlgEdDSA:
+		key, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		if !ed25519.Verify(key, message, sig) {
+			return fmt.Errorf("%w: bad signature", ErrVerification)
+		}
+		return nil
+	case AlgRS256:
+		key, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		digest := sha256.Sum256(message)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return fmt.Errorf("%w: bad signature", ErrVerification)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: algorithm %d", ErrUnsupportedKey, alg)
+	}
+}
+
+// certificateKeyMatches reports whether an attestation certificate carries
+// the kind of key the statement's COSE algorithm signs with.
+func certificateKeyMatches(cert *x509.Certificate, alg int64) bool {
+	switch alg {
+	case AlgES256:
+		return cert.PublicKeyAlgorithm == x509.ECDSA
+	case AlgEdDSA:
+		return cert.PublicKeyAlgorithm == x509.Ed25519
+	case AlgRS256:
+		return cert.PublicKeyAlgorithm == x509.RSA
+	default:
+		return false
+	}
+}
@@ -0,0 +1,220 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+// cborHead encodes the initial byte and argument of a CBOR item.
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	default:
+		return []byte{major<<5 | 26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+}
+
+// encodeCOSEKey encodes a COSE_Key whose values are integers or byte strings.
+func encodeCOSEKey(params map[int64]interface{}) []byte {
+	keys := make([]int64, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	b := cborHead(5, uint64(len(params)))
+	for _, k := range keys {
+		for _, item := range []interface{}{k, params[k]} {
+			switch v := item.(type) {
+			case int64:
+				if v >= 0 {
+					b = append(b, cborHead(0, uint64(v))...)
+				} else {
+					b = append(b, cborHead(1, uint64(-1-v))...)
+				}
+			case []byte:
+				b = append(b, cborHead(2, uint64(len(v)))...)
+				b = append(b, v...)
+			}
+		}
+	}
+	return b
+}
+
+func ec2Key(pub *ecdsa.PublicKey) map[int64]interface{} {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return map[int64]interface{}{
+		coseKty: int64(coseKtyEC2),
+		coseAlg: AlgES256,
+		coseCrv: int64(coseCrvP256),
+		coseX:   x,
+		coseY:   y,
+	}
+}
+
+func TestParsePublicKeyES256(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKey(encodeCOSEKey(ec2Key(&priv.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Algorithm != AlgES256 {
+		t.Errorf("Algorithm = %d, want %d", key.Algorithm, AlgES256)
+	}
+
+	message := []byte("authenticator data and client data hash")
+	digest := sha256.Sum256(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := key.Verify(message, sig); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := key.Verify([]byte("something else"), sig); !errors.Is(err, ErrVerification) {
+		t.Errorf("Verify of another message = %v, want ErrVerification", err)
+	}
+}
+
+func TestParsePublicKeyEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKey(encodeCOSEKey(map[int64]interface{}{
+		coseKty: int64(coseKtyOKP),
+		coseAlg: AlgEdDSA,
+		coseCrv: int64(coseCrvEd25519),
+		coseX:   []byte(pub),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("authenticator data and client data hash")
+	if err := key.Verify(message, ed25519.Sign(priv, message)); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := key.Verify(message, make([]byte, ed25519.SignatureSize)); !errors.Is(err, ErrVerification) {
+		t.Errorf("Verify of a zero signature = %v, want ErrVerification", err)
+	}
+}
+
+func TestParsePublicKeyRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKey(encodeCOSEKey(map[int64]interface{}{
+		coseKty: int64(coseKtyRSA),
+		coseAlg: AlgRS256,
+		coseN:   priv.N.Bytes(),
+		coseE:   big.NewInt(int64(priv.E)).Bytes(),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("authenticator data and client data hash")
+	digest := sha256.Sum256(message)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(message, sig); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestParsePublicKeyMalformed(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(k int64, v interface{}) []byte {
+		params := ec2Key(&priv.PublicKey)
+		if v == nil {
+			delete(params, k)
+		} else {
+			params[k] = v
+		}
+		return encodeCOSEKey(params)
+	}
+
+	offCurve := make([]byte, 32)
+	offCurve[31] = 1
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"not CBOR", []byte{0xff}},
+		{"not a map", []byte{0x83, 0x01, 0x02, 0x03}},
+		{"trailing data", append(encodeCOSEKey(ec2Key(&priv.PublicKey)), 0x00)},
+		{"missing kty", with(coseKty, nil)},
+		{"wrong algorithm", with(coseAlg, AlgRS256)},
+		{"unknown algorithm", with(coseAlg, int64(-35))},
+		{"wrong curve", with(coseCrv, int64(2))},
+		{"missing y", with(coseY, nil)},
+		{"short x", with(coseX, make([]byte, 31))},
+		{"x as integer", with(coseX, int64(1))},
+		{"point not on the curve", with(coseY, offCurve)},
+		{"short Ed25519 key", encodeCOSEKey(map[int64]interface{}{
+			coseKty: int64(coseKtyOKP),
+			coseAlg: AlgEdDSA,
+			coseCrv: int64(coseCrvEd25519),
+			coseX:   make([]byte, 31),
+		})},
+		{"RSA key under 2048 bits", encodeCOSEKey(map[int64]interface{}{
+			coseKty: int64(coseKtyRSA),
+			coseAlg: AlgRS256,
+			coseN:   small.N.Bytes(),
+			coseE:   big.NewInt(int64(small.E)).Bytes(),
+		})},
+		{"RSA exponent too long", encodeCOSEKey(map[int64]interface{}{
+			coseKty: int64(coseKtyRSA),
+			coseAlg: AlgRS256,
+			coseN:   small.N.Bytes(),
+			coseE:   make([]byte, 5),
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePublicKey(tt.b)
+			if !errors.Is(err, ErrUnsupportedKey) && !errors.Is(err, ErrVerification) {
+				t.Errorf("ParsePublicKey(%x) error = %v, want ErrUnsupportedKey or ErrVerification", tt.b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package webauthn
+
+import "time"
+
+// Timeout is how long the browser gives the user to complete a ceremony.
+// Servers should keep the challenge for at least as long.
+const Timeout = 5 * time.Minute
+
+// User is the account a credential is registered for. ID is the user
+// handle authenticators store with a discoverable credential and return
+// when it is used.
+type User struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is the JSON form of PublicKeyCredentialCreationOptions,
+// the argument to navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is the JSON form of PublicKeyCredentialRequestOptions, the
+// argument to navigator.credentials.get(). An empty AllowCredentials lets
+// the user pick any discoverable credential for the relying party.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func (c Config) userVerification() string {
+	if c.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+// CreationOptions returns the options for registering a credential for
+// user. exclude lists the credentials the user already has, so the same
+// authenticator is not registered twice.
+func (c Config) CreationOptions(challenge Bytes, user User, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, len(Algorithms))
+	for i, alg := range Algorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 RelyingParty{ID: c.RPID, Name: c.RPName},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: c.userVerification(),
+		},
+		Attestation: "direct",
+	}
+}
+
+// RequestOptions returns the options for asserting one of the allowed
+// credentials, or any discoverable one when allow is empty.
+func (c Config) RequestOptions(challenge Bytes, allow []CredentialDescriptor) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             c.RPID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: c.userVerification(),
+	}
+}
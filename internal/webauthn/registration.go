@@ -0,0 +1,197 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// Attestation types recorded for a credential.
+const (
+	AttestationNone  = "none"
+	AttestationSelf  = "self"
+	AttestationBasic = "basic"
+)
+
+var ErrUnsupportedAttestation = errors.New("webauthn: unsupported attestation format")
+
+// idFidoGenCeAAGUID is the certificate extension in which packed attestation
+// certificates may state the authenticator model.
+var idFidoGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// Credential is a newly registered credential, to be stored for the user.
+type Credential struct {
+	ID              []byte
+	PublicKey       []byte
+	Algorithm       int64
+	SignCount       uint32
+	AAGUID          []byte
+	AttestationType string
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create()
+// for the challenge the server issued, and returns the credential to store.
+func (c Config) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	err := c.verifyClientData(clientDataJSON, ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := item.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+
+	format, _ := obj["fmt"].(string)
+	rawAuthData, _ := obj["authData"].([]byte)
+	stmt, ok := obj["attStmt"].(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: missing attestation statement", ErrVerification)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = c.verifyAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrVerification)
+	}
+
+	pub, err := ParsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &Credential{
+		ID:        append([]byte(nil), authData.CredentialID...),
+		PublicKey: append([]byte(nil), authData.PublicKey...),
+		Algorithm: pub.Algorithm,
+		SignCount: authData.SignCount,
+		AAGUID:    append([]byte(nil), authData.AAGUID...),
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return nil, fmt.Errorf("%w: none attestation with a statement", ErrVerification)
+		}
+		cred.AttestationType = AttestationNone
+	case "packed":
+		cred.AttestationType, err = verifyPacked(stmt, signed, pub, authData.AAGUID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedAttestation, format)
+	}
+
+	return cred, nil
+}
+
+// verifyPacked checks a packed attestation statement. Without certificates
+// it is self attestation, signed by the credential key itself.
+func verifyPacked(stmt map[interface{}]interface{}, signed []byte, pub *PublicKey, aaguid []byte) (string, error) {
+	alg, ok := stmtAlg(stmt)
+	sig, okSig := stmt["sig"].([]byte)
+	if !ok || !okSig {
+		return "", fmt.Errorf("%w: malformed packed statement", ErrVerification)
+	}
+
+	x5c, hasX5C := stmt["x5c"].([]interface{})
+	if !hasX5C {
+		if alg != pub.Algorithm {
+			return "", fmt.Errorf("%w: self attestation algorithm differs from the credential's", ErrVerification)
+		}
+		err := pub.Verify(signed, sig)
+		if err != nil {
+			return "", err
+		}
+		return AttestationSelf, nil
+	}
+
+	if len(x5c) == 0 {
+		return "", fmt.Errorf("%w: empty certificate chain", ErrVerification)
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return "", fmt.Errorf("%w: malformed certificate chain", ErrVerification)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("%w: attestation certificate: %v", ErrVerification, err)
+	}
+
+	err = verifyPackedCertificate(cert, aaguid)
+	if err != nil {
+		return "", err
+	}
+
+	if !certificateKeyMatches(cert, alg) {
+		return "", fmt.Errorf("%w: certificate key does not match algorithm %d", ErrVerification, alg)
+	}
+	err = verifySignature(cert.PublicKey, alg, signed, sig)
+	if err != nil {
+		return "", err
+	}
+	return AttestationBasic, nil
+}
+
+// stmtAlg reads the "alg" entry of an attestation statement.
+func stmtAlg(stmt map[interface{}]interface{}) (int64, bool) {
+	switch v := stmt["alg"].(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// verifyPackedCertificate checks the requirements the packed format places
+// on attestation certificates.
+func verifyPackedCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 {
+		return fmt.Errorf("%w: attestation certificate is not version 3", ErrVerification)
+	}
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return fmt.Errorf("%w: attestation certificate is a CA", ErrVerification)
+	}
+
+	subject := cert.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" {
+		return fmt.Errorf("%w: attestation certificate subject incomplete", ErrVerification)
+	}
+	if len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "Authenticator Attestation" {
+		return fmt.Errorf("%w: attestation certificate has the wrong organizational unit", ErrVerification)
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idFidoGenCeAAGUID) {
+			continue
+		}
+		if ext.Critical {
+			return fmt.Errorf("%w: AAGUID extension marked critical", ErrVerification)
+		}
+		var certAAGUID []byte
+		_, err := asn1.Unmarshal(ext.Value, &certAAGUID)
+		if err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return fmt.Errorf("%w: AAGUID does not match the attestation certificate", ErrVerification)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package webauthn verifies the two WebAuthn ceremonies: registering a
+// credential (a passkey or security key) and asserting it to log in. It
+// accepts "none" and "packed" attestation, and ES256, EdDSA and RS256 keys.
+//
+// Attestation certificates are checked for the signature and the fields the
+// packed format requires, but not chained to vendor roots: the service trusts
+// any authenticator, and the attestation only records what it claimed to be.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	challengeSize = 32
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+var (
+	ErrVerification = errors.New("webauthn: verification failed")
+	// ErrSignCount means the authenticator's signature counter did not move
+	// forward, which is what a cloned authenticator looks like.
+	ErrSignCount = errors.New("webauthn: signature counter did not increase")
+)
+
+// Config identifies the relying party: the site credentials are scoped to.
+type Config struct {
+	// RPID is the domain credentials are bound to, such as "example.com".
+	RPID   string
+	RPName string
+	// Origins lists the origins pages running the ceremonies are served
+	// from, such as "https://example.com".
+	Origins []string
+	// RequireUserVerification rejects assertions where the authenticator
+	// did not verify the user with a PIN or biometric.
+	RequireUserVerification bool
+}
+
+// Bytes is binary data sent as unpadded base64url, the encoding browsers'
+// WebAuthn helpers and the specification's JSON forms use.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := DecodeBytes(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+func (b Bytes) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBytes decodes base64url, with or without padding.
+func DecodeBytes(s string) (Bytes, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewChallenge returns the random value a ceremony signs over.
+func NewChallenge() (Bytes, error) {
+	challenge := make([]byte, challengeSize)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ClientData is what the browser says about the ceremony it ran.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData decodes clientDataJSON. Servers that keep challenges by
+// value read the challenge from it to find the ceremony it belongs to; the
+// Verify functions check it again.
+func ParseClientData(raw []byte) (*ClientData, Bytes, error) {
+	var cd ClientData
+	err := json.Unmarshal(raw, &cd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: client data: %v", ErrVerification, err)
+	}
+
+	challenge, err := DecodeBytes(cd.Challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: client data challenge: %v", ErrVerification, err)
+	}
+	return &cd, challenge, nil
+}
+
+func (c Config) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	cd, got, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: client data type %q, want %q", ErrVerification, cd.Type, ceremony)
+	}
+	if subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if cd.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremony", ErrVerification)
+	}
+
+	for _, origin := range c.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q not allowed", ErrVerification, cd.Origin)
+}
+
+// AuthenticatorData is the authenticator's signed statement about a
+// ceremony.
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Set during registration only.
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func (d *AuthenticatorData) UserPresent() bool  { return d.Flags&flagUserPresent != 0 }
+func (d *AuthenticatorData) UserVerified() bool { return d.Flags&flagUserVerified != 0 }
+
+func parseAuthenticatorData(b []byte) (*AuthenticatorData, error) {
+	if len(b) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+
+	d := &AuthenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+
+	if d.Flags&flagAttested != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+		}
+		d.AAGUID = rest[:16]
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return nil, fmt.Errorf("%w: bad credential ID length", ErrVerification)
+		}
+		d.CredentialID = rest[:n]
+		rest = rest[n:]
+
+		_, after, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, err
+		}
+		d.PublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if d.Flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrVerification)
+	}
+	return d, nil
+}
+
+func (c Config) verifyAuthenticatorData(d *AuthenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(d.RPIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: credential is for another relying party", ErrVerification)
+	}
+	if !d.UserPresent() {
+		return fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	if c.RequireUserVerification && !d.UserVerified() {
+		return fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    login text NOT NULL,
+    password_hash bytea NOT NULL,
+    name text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT '',
+    role text NOT NULL DEFAULT '',
+    CONSTRAINT users_email_key UNIQUE (login)
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    hash bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL,
+    scope text NOT NULL,
+    is_exposed boolean NOT NULL DEFAULT false
+);
@@ -0,0 +1,3 @@
+ALTER TABLE tokens ADD COLUMN family_id text;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
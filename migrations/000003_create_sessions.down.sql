@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_family_id_fkey;
+
+DROP TABLE IF EXISTS sessions;
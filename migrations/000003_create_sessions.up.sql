@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id text PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    device_name text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+INSERT INTO sessions (id, user_id)
+SELECT DISTINCT family_id, user_id FROM tokens WHERE family_id IS NOT NULL;
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_family_id_fkey
+    FOREIGN KEY (family_id) REFERENCES sessions ON DELETE CASCADE;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS revocations (
+    kind text NOT NULL,
+    value text NOT NULL,
+    revoked_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp with time zone NOT NULL,
+    PRIMARY KEY (kind, value)
+);
+
+CREATE INDEX IF NOT EXISTS revocations_expiry_idx ON revocations (expiry);
@@ -0,0 +1,3 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS clients;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS clients (
+    id text PRIMARY KEY,
+    secret_hash bytea,
+    name text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE sessions ADD COLUMN client_id text REFERENCES clients ON DELETE CASCADE;
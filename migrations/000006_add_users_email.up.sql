@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN email text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email));
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT '';
+ALTER TABLE users ALTER COLUMN status SET DEFAULT '';
@@ -0,0 +1,8 @@
+UPDATE users SET status = 'active' WHERE status NOT IN ('pending', 'active', 'suspended', 'deleted');
+-- Until now registration took the role from the request body, so no role
+-- already in the table can be trusted. Admins have to be granted again.
+UPDATE users SET role = 'user' WHERE role IS DISTINCT FROM 'user';
+
+ALTER TABLE users ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active', 'suspended', 'deleted'));
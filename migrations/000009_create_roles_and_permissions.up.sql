@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name text PRIMARY KEY,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    code text PRIMARY KEY,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role text NOT NULL REFERENCES roles ON DELETE CASCADE ON UPDATE CASCADE,
+    permission text NOT NULL REFERENCES permissions ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'a regular user'),
+    ('admin', 'manages users and their access')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (code, description) VALUES
+    ('users:read', 'view any user'),
+    ('users:write', 'change any user''s status and role')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write')
+ON CONFLICT DO NOTHING;
+
+-- Only the roles above exist. Any other value in users.role is left over
+-- from client-supplied roles, and admin is granted by hand from here on, so
+-- every existing account starts out as a plain user.
+UPDATE users SET role = 'user' WHERE role IS DISTINCT FROM 'user';
+
+ALTER TABLE users ADD CONSTRAINT users_role_fkey
+    FOREIGN KEY (role) REFERENCES roles ON UPDATE CASCADE;
@@ -0,0 +1,16 @@
+DELETE FROM roles_permissions
+WHERE permission IN ('users:*', 'roles:read', 'roles:write', 'roles:*');
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:write')
+ON CONFLICT DO NOTHING;
+
+DELETE FROM permissions
+WHERE code IN ('users:*', 'roles:read', 'roles:write', 'roles:*');
+
+-- Moderators go back to being plain users before the role itself goes.
+UPDATE users SET role = 'user' WHERE role = 'moderator';
+DELETE FROM roles WHERE name = 'moderator';
+
+DROP TABLE IF EXISTS role_parents;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS role_parents (
+    role text NOT NULL REFERENCES roles ON DELETE CASCADE ON UPDATE CASCADE,
+    parent text NOT NULL REFERENCES roles ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (role, parent),
+    CONSTRAINT role_parents_not_self CHECK (role <> parent)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('moderator', 'views users on behalf of admins')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (code, description) VALUES
+    ('users:*', 'every users permission'),
+    ('roles:read', 'view roles and what they grant'),
+    ('roles:write', 'change roles and what they grant'),
+    ('roles:*', 'every roles permission')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_parents (role, parent) VALUES
+    ('moderator', 'user'),
+    ('admin', 'moderator')
+ON CONFLICT DO NOTHING;
+
+DELETE FROM roles_permissions
+WHERE role = 'admin' AND permission IN ('users:read', 'users:write');
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('moderator', 'users:read'),
+    ('admin', 'users:*'),
+    ('admin', 'roles:*')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+INSERT INTO permissions (code, description) VALUES
+    ('policies:explain', 'see how policies decide for any user')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'policies:explain')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM permissions
+WHERE code IN ('relations:read', 'relations:write', 'relations:*');
+
+DROP TABLE IF EXISTS relation_tuples;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS relation_tuples (
+    namespace text NOT NULL,
+    object_id text NOT NULL,
+    relation text NOT NULL,
+    subject_namespace text NOT NULL,
+    subject_id text NOT NULL,
+    subject_relation text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+);
+
+CREATE INDEX IF NOT EXISTS relation_tuples_subject_idx
+    ON relation_tuples (subject_namespace, subject_id, subject_relation);
+
+INSERT INTO permissions (code, description) VALUES
+    ('relations:read', 'check and expand relation tuples'),
+    ('relations:write', 'write and delete relation tuples'),
+    ('relations:*', 'every relations permission')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'relations:*')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    slug text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS organizations_slug_unique_idx ON organizations (lower(slug));
+
+CREATE TABLE IF NOT EXISTS memberships (
+    org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL REFERENCES roles ON UPDATE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships (user_id);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS org_id bigint REFERENCES organizations ON DELETE SET NULL;
+
+-- Tuples now belong to an organization. There is no organization to move
+-- tuples written before now into, so refuse to run rather than leave them
+-- unscoped where no query would ever find them again.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM relation_tuples) THEN
+        RAISE EXCEPTION 'relation_tuples has rows without an organization; move or delete them before migrating';
+    END IF;
+END $$;
+
+ALTER TABLE relation_tuples ADD COLUMN IF NOT EXISTS org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE relation_tuples DROP CONSTRAINT IF EXISTS relation_tuples_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS relation_tuples_unique_idx
+    ON relation_tuples (org_id, namespace, object_id, relation, subject_namespace, subject_id, subject_relation);
+DROP INDEX IF EXISTS relation_tuples_subject_idx;
+CREATE INDEX IF NOT EXISTS relation_tuples_subject_idx
+    ON relation_tuples (org_id, subject_namespace, subject_id, subject_relation);
@@ -0,0 +1,6 @@
+DELETE FROM permissions
+WHERE code IN ('members:read', 'members:write', 'members:*');
+
+DELETE FROM tokens WHERE scope = 'invitation';
+
+DROP TABLE IF EXISTS invitations;
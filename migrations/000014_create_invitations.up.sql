@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    email text NOT NULL,
+    role text NOT NULL REFERENCES roles ON UPDATE CASCADE,
+    invited_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    token_hash bytea NOT NULL UNIQUE REFERENCES tokens ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_org_id_idx ON invitations (org_id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('members:read', 'view the members and pending invitations of an organization'),
+    ('members:write', 'invite and remove members of an organization'),
+    ('members:*', 'every members permission')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'members:*')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM tokens WHERE scope = 'mfa-pending';
+
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL DEFAULT '',
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    aaguid bytea NOT NULL,
+    attestation_type text NOT NULL,
+    transports text[] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    hash bytea PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    ceremony text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS login_otps;
+
+DROP INDEX IF EXISTS users_phone_unique_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_unique_idx ON users (phone);
+
+CREATE TABLE IF NOT EXISTS login_otps (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    channel text NOT NULL,
+    code_hash bytea NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,7 @@
+INSERT INTO permissions (code, description) VALUES
+    ('metrics:read', 'view the server metrics under /debug/vars')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role, permission) VALUES
+    ('admin', 'metrics:read')
+ON CONFLICT DO NOTHING;
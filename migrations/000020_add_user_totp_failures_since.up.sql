@@ -0,0 +1 @@
+ALTER TABLE user_totp ADD COLUMN IF NOT EXISTS failures_since timestamp(0) with time zone NOT NULL DEFAULT NOW();
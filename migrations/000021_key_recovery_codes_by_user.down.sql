@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+ALTER TABLE recovery_codes DROP CONSTRAINT IF EXISTS recovery_codes_pkey;
+ALTER TABLE recovery_codes ADD PRIMARY KEY (hash);
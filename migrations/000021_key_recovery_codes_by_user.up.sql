@@ -0,0 +1,3 @@
+ALTER TABLE recovery_codes DROP CONSTRAINT IF EXISTS recovery_codes_pkey;
+ALTER TABLE recovery_codes ADD PRIMARY KEY (user_id, hash);
+DROP INDEX IF EXISTS recovery_codes_user_id_idx;
@@ -0,0 +1,9 @@
+DELETE FROM login_otps WHERE purpose <> 'login';
+ALTER TABLE login_otps DROP CONSTRAINT IF EXISTS login_otps_pkey;
+ALTER TABLE login_otps ADD PRIMARY KEY (user_id);
+ALTER TABLE login_otps DROP COLUMN IF EXISTS purpose;
+
+UPDATE users SET phone = NULL WHERE NOT phone_verified;
+DROP INDEX IF EXISTS users_phone_unique_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_unique_idx ON users (phone);
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified;
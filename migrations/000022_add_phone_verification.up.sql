@@ -0,0 +1,11 @@
+-- No phone number given so far has been verified. Only verified numbers have
+-- to be unique, so claiming a number reveals nothing about other accounts.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified boolean NOT NULL DEFAULT false;
+DROP INDEX IF EXISTS users_phone_unique_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_unique_idx ON users (phone) WHERE phone_verified;
+
+-- One-time passcodes are no longer only for logging in: a user can have one
+-- outstanding code per purpose.
+ALTER TABLE login_otps ADD COLUMN IF NOT EXISTS purpose text NOT NULL DEFAULT 'login';
+ALTER TABLE login_otps DROP CONSTRAINT IF EXISTS login_otps_pkey;
+ALTER TABLE login_otps ADD PRIMARY KEY (user_id, purpose);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS otp_counters (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    window_start timestamp(0) with time zone NOT NULL,
+    issued integer NOT NULL DEFAULT 0,
+    failures integer NOT NULL DEFAULT 0
+);